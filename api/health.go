@@ -1,12 +1,11 @@
 package api
 
 import (
-	"fmt"
-	"log"
 	"net/http"
 
 	"github.com/go-chi/render"
-	"github.com/nimbo-stratuz/bikeshare-directions/service"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/health"
 )
 
 // HealthCheckResponse is a microprofile-like /health response
@@ -17,7 +16,7 @@ type HealthCheckResponse struct {
 
 // Render sets HTTP Status to 503 if outcome equals DOWN
 func (hcr *HealthCheckResponse) Render(w http.ResponseWriter, r *http.Request) error {
-	if hcr.Outcome == stateDown {
+	if hcr.Outcome == health.StateDown {
 		render.Status(r, http.StatusServiceUnavailable)
 	}
 
@@ -26,84 +25,38 @@ func (hcr *HealthCheckResponse) Render(w http.ResponseWriter, r *http.Request) e
 
 // SubHealthCheck represents underlying health checks
 type SubHealthCheck struct {
-	Name  string `json:"name"`
-	State string `json:"state"`
+	Name  string                 `json:"name"`
+	State string                 `json:"state"`
+	Data  map[string]interface{} `json:"data,omitempty"`
 }
 
-var (
-	url = ""
-)
-
-const (
-	stateUp   = "UP"
-	stateDown = "DOWN"
-)
-
-// HealthCheck is a basic Healthcheck
-func HealthCheck(w http.ResponseWriter, r *http.Request) {
-
-	if url == "" {
-		apiKey, err := service.Config.Get("maps", "api", "key")
-		if err != nil {
-			log.Panicln("API key not set")
-		}
-
-		url = fmt.Sprintf("https://www.mapquestapi.com/directions/v2/route?key=%s", apiKey)
-	}
+// Liveness reports whether the process is able to serve requests.
+// It does not depend on other services, so that their outages do not
+// get the pod restarted.
+func Liveness(w http.ResponseWriter, r *http.Request) {
+	render.Render(w, r, &HealthCheckResponse{
+		Outcome: health.StateUp,
+		Checks:  []SubHealthCheck{},
+	})
+}
 
-	checks := []SubHealthCheck{
-		doMapQuestHealthCheck(),
-	}
+// Readiness reports whether the service can handle requests, by running
+// the checks registered with health.Register
+func Readiness(w http.ResponseWriter, r *http.Request) {
 
-	state := stateUp
+	outcome, results := health.Default.Check()
 
-	for _, chk := range checks {
-		if chk.State == stateDown {
-			state = stateDown
-			break
+	checks := make([]SubHealthCheck, len(results))
+	for i, result := range results {
+		checks[i] = SubHealthCheck{
+			Name:  result.Name,
+			State: result.State,
+			Data:  result.Data,
 		}
 	}
 
-	hc := HealthCheckResponse{
-		Outcome: state,
+	render.Render(w, r, &HealthCheckResponse{
+		Outcome: outcome,
 		Checks:  checks,
-	}
-
-	render.Render(w, r, &hc)
-}
-
-func mapQuestHealthCheck(isUp bool) SubHealthCheck {
-
-	var state string
-	if isUp {
-		state = stateUp
-	} else {
-		state = stateDown
-	}
-
-	return SubHealthCheck{
-		Name:  "MapQuestHealthCheck",
-		State: state,
-	}
-}
-
-func doMapQuestHealthCheck() SubHealthCheck {
-
-	req, err := http.NewRequest("OPTIONS", url, nil)
-	if err != nil {
-		return mapQuestHealthCheck(false)
-	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return mapQuestHealthCheck(false)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return mapQuestHealthCheck(false)
-	}
-
-	return mapQuestHealthCheck(true)
+	})
 }
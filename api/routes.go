@@ -1,8 +1,11 @@
 package api
 
 import (
+	"expvar"
+
 	"github.com/go-chi/chi"
 	"github.com/nimbo-stratuz/bikeshare-directions/handlers"
+	"github.com/nimbo-stratuz/bikeshare-directions/metrics"
 )
 
 // Routes for resource 'directions'
@@ -17,9 +20,29 @@ func Routes() *chi.Mux {
 	})
 
 	r.Route("/health", func(r chi.Router) {
-		r.Get("/", HealthCheck)
-		r.Head("/", HealthCheck)
+		r.Get("/", Readiness)
+		r.Head("/", Readiness)
+
+		r.Get("/live", Liveness)
+		r.Head("/live", Liveness)
+
+		r.Get("/ready", Readiness)
+		r.Head("/ready", Readiness)
+	})
+
+	// Authenticated with the bearer token in admin.token
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(handlers.AdminAuth)
+
+		r.Get("/config", handlers.AdminConfig)
+		r.Put("/config/{key}", handlers.PutAdminConfig)
+
+		// Runtime, coalescing and quota statistics
+		r.Get("/debug/vars", expvar.Handler().ServeHTTP)
 	})
 
+	// Prometheus metrics
+	r.Get("/metrics", metrics.Handler())
+
 	return r
 }
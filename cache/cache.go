@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrMiss is returned by Get when the key is not cached
+var ErrMiss = errors.New("cache: key not found")
+
+// Cache is a common interface for key-value caches with expiration
+type Cache interface {
+	Get(key string) ([]byte, error)                        // Get returns ErrMiss if the key is not cached
+	Set(key string, value []byte, ttl time.Duration) error // Set stores value for ttl (0 means no expiration)
+	Close() error
+}
+
+// Pinger is a Cache backed by a server (supports method Ping)
+type Pinger interface {
+	Ping(ctx context.Context) error // Check that the server is reachable, without reading any key
+}
+
+// GetJSON reads key from the cache and decodes it into v
+func GetJSON(c Cache, key string, v interface{}) error {
+
+	value, err := c.Get(key)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(value, v)
+}
+
+// SetJSON encodes v as JSON and stores it in the cache
+func SetJSON(c Cache, key string, v interface{}, ttl time.Duration) error {
+
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return c.Set(key, value, ttl)
+}
@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// fallbackCache combines a per-process cache with a cache shared between
+// instances. When the shared cache fails, it is skipped for a while and
+// only the local cache is used.
+type fallbackCache struct {
+	local  Cache
+	shared Cache
+
+	localTTL   time.Duration // TTL of values copied from shared to local
+	retryAfter time.Duration
+
+	mutex     *sync.Mutex
+	downUntil time.Time
+}
+
+// NewFallback creates a Cache that reads from local first, then shared.
+// Values are written to both; values read from shared are kept locally
+// for localTTL. If shared returns an error, it is not used again until
+// retryAfter elapses.
+func NewFallback(local, shared Cache, localTTL, retryAfter time.Duration) Cache {
+	return &fallbackCache{
+		local:      local,
+		shared:     shared,
+		localTTL:   localTTL,
+		retryAfter: retryAfter,
+		mutex:      &sync.Mutex{},
+	}
+}
+
+// Close closes both underlying caches
+func (fc *fallbackCache) Close() error {
+
+	var errs []string
+
+	for _, c := range []Cache{fc.shared, fc.local} {
+		if err := c.Close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+
+	return nil
+}
+
+// Get returns the value for the specified key
+func (fc *fallbackCache) Get(key string) ([]byte, error) {
+
+	if value, err := fc.local.Get(key); err == nil {
+		return value, nil
+	}
+
+	if !fc.sharedAvailable() {
+		return nil, ErrMiss
+	}
+
+	value, err := fc.shared.Get(key)
+	if err == ErrMiss {
+		return nil, ErrMiss
+	} else if err != nil {
+		fc.sharedFailed(err)
+		return nil, ErrMiss
+	}
+
+	fc.local.Set(key, value, fc.localTTL)
+
+	return value, nil
+}
+
+// Set stores the value in both caches
+func (fc *fallbackCache) Set(key string, value []byte, ttl time.Duration) error {
+
+	if err := fc.local.Set(key, value, ttl); err != nil {
+		return err
+	}
+
+	if fc.sharedAvailable() {
+		if err := fc.shared.Set(key, value, ttl); err != nil {
+			fc.sharedFailed(err)
+		}
+	}
+
+	return nil
+}
+
+// Name of the health check
+func (fc *fallbackCache) Name() string {
+	return "CacheHealthCheck"
+}
+
+// Check pings the shared cache. Its failures are reported in data only,
+// since the local cache is used meanwhile.
+func (fc *fallbackCache) Check(ctx context.Context) (map[string]interface{}, error) {
+
+	data := map[string]interface{}{"shared": "UP"}
+
+	pinger, ok := fc.shared.(Pinger)
+	if !ok {
+		return data, nil
+	}
+
+	if err := pinger.Ping(ctx); err != nil {
+		data["shared"] = "DOWN"
+		data["sharedError"] = err.Error()
+	}
+
+	return data, nil
+}
+
+func (fc *fallbackCache) sharedAvailable() bool {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	return time.Now().After(fc.downUntil)
+}
+
+func (fc *fallbackCache) sharedFailed(err error) {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	log.Warnf("Shared cache unavailable, using local cache for %s: %s", fc.retryAfter, err)
+	fc.downUntil = time.Now().Add(fc.retryAfter)
+}
@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeShared is a shared Cache that counts lookups and pings
+type fakeShared struct {
+	Cache
+	gets    int
+	pings   int
+	pingErr error
+}
+
+func (fs *fakeShared) Get(key string) ([]byte, error) {
+	fs.gets++
+	return fs.Cache.Get(key)
+}
+
+func (fs *fakeShared) Ping(ctx context.Context) error {
+	fs.pings++
+	return fs.pingErr
+}
+
+func TestFallbackCheck(t *testing.T) {
+
+	tests := []struct {
+		pingErr error
+		want    string
+	}{
+		{nil, "UP"},
+		{errors.New("connection refused"), "DOWN"},
+	}
+
+	for _, test := range tests {
+		shared := &fakeShared{Cache: NewLocal(10), pingErr: test.pingErr}
+		fc := NewFallback(NewLocal(10), NewInstrumented("shared", shared), time.Minute, time.Minute)
+
+		data, err := fc.(*fallbackCache).Check(context.Background())
+
+		// The local cache serves requests meanwhile
+		if err != nil {
+			t.Errorf("Check() error = %v, want nil", err)
+		}
+		if data["shared"] != test.want {
+			t.Errorf("Check() shared = %v, want %s", data["shared"], test.want)
+		}
+
+		// Probes are not counted as cache misses
+		if shared.pings != 1 || shared.gets != 0 {
+			t.Errorf("Check() made %d pings and %d lookups, want 1 and 0", shared.pings, shared.gets)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/metrics"
+)
+
+var requests = metrics.NewCounter(
+	"cache_requests_total",
+	"Number of cache lookups by cache and result (hit, miss, error).",
+	"cache", "result",
+)
+
+// instrumented is a Cache that counts hits and misses
+type instrumented struct {
+	Cache
+	name string
+}
+
+// NewInstrumented creates a Cache that counts hits, misses and errors
+// of c in metrics, labeled with name
+func NewInstrumented(name string, c Cache) Cache {
+	return &instrumented{c, name}
+}
+
+func (i *instrumented) Get(key string) ([]byte, error) {
+
+	value, err := i.Cache.Get(key)
+
+	switch err {
+	case nil:
+		requests.Inc(i.name, "hit")
+	case ErrMiss:
+		requests.Inc(i.name, "miss")
+	default:
+		requests.Inc(i.name, "error")
+	}
+
+	return value, err
+}
+
+func (i *instrumented) Set(key string, value []byte, ttl time.Duration) error {
+	return i.Cache.Set(key, value, ttl)
+}
+
+// Ping probes the underlying cache without counting a lookup. Caches
+// without a server are always reachable.
+func (i *instrumented) Ping(ctx context.Context) error {
+
+	if pinger, ok := i.Cache.(Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// localCache is an in-memory LRU cache, local to the process
+type localCache struct {
+	mutex      *sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List // Most recently used entries are at the front
+}
+
+type localEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLocal creates an in-memory cache holding at most maxEntries entries
+func NewLocal(maxEntries int) Cache {
+
+	if maxEntries <= 0 {
+		maxEntries = 1
+	}
+
+	return &localCache{
+		mutex:      &sync.Mutex{},
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Close does nothing for localCache
+func (lc *localCache) Close() error {
+	return nil
+}
+
+// Get returns the value for the specified key
+func (lc *localCache) Get(key string) ([]byte, error) {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+
+	elem, ok := lc.entries[key]
+	if !ok {
+		return nil, ErrMiss
+	}
+
+	entry := elem.Value.(*localEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		lc.remove(elem)
+		return nil, ErrMiss
+	}
+
+	lc.lru.MoveToFront(elem)
+
+	return entry.value, nil
+}
+
+// Set stores the value for the specified key, evicting the least
+// recently used entry if the cache is full
+func (lc *localCache) Set(key string, value []byte, ttl time.Duration) error {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+
+	if elem, ok := lc.entries[key]; ok {
+		elem.Value = &localEntry{key, value, expires}
+		lc.lru.MoveToFront(elem)
+		return nil
+	}
+
+	lc.entries[key] = lc.lru.PushFront(&localEntry{key, value, expires})
+
+	for lc.lru.Len() > lc.maxEntries {
+		lc.remove(lc.lru.Back())
+	}
+
+	return nil
+}
+
+func (lc *localCache) remove(elem *list.Element) {
+	lc.lru.Remove(elem)
+	delete(lc.entries, elem.Value.(*localEntry).key)
+}
@@ -0,0 +1,292 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// redisCache is a Cache shared between instances, stored in any server
+// speaking the Redis protocol (RESP)
+type redisCache struct {
+	addr     string
+	password string
+	db       int
+	prefix   string
+	timeout  time.Duration
+
+	pool chan *redisConn // Idle connections
+}
+
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// redisError is an error reply sent by the server
+type redisError string
+
+func (re redisError) Error() string {
+	return "redis: " + string(re)
+}
+
+const redisPoolSize = 8
+
+// NewRedis creates a Cache backed by the Redis server at rawURL
+// (redis://[:password@]host:port[/db]). All keys are prefixed with prefix.
+func NewRedis(rawURL, prefix string, timeout time.Duration) (Cache, error) {
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("Unsupported cache URL scheme: %s", u.Scheme)
+	}
+
+	rc := &redisCache{
+		addr:    u.Host,
+		prefix:  prefix,
+		timeout: timeout,
+		pool:    make(chan *redisConn, redisPoolSize),
+	}
+
+	if u.User != nil {
+		rc.password, _ = u.User.Password()
+	}
+
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if rc.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("Invalid redis database: %s", db)
+		}
+	}
+
+	if !strings.Contains(rc.addr, ":") {
+		rc.addr += ":6379"
+	}
+
+	return rc, nil
+}
+
+// Close closes all idle connections
+func (rc *redisCache) Close() error {
+
+	log.Info("Closing redisCache")
+
+	for {
+		select {
+		case c := <-rc.pool:
+			c.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// Get returns the value for the specified key
+func (rc *redisCache) Get(key string) ([]byte, error) {
+
+	reply, err := rc.do(rc.timeout, "GET", rc.prefix+key)
+	if err != nil {
+		return nil, err
+	}
+
+	if reply == nil {
+		return nil, ErrMiss
+	}
+
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply to GET: %v", reply)
+	}
+
+	return value, nil
+}
+
+// Set stores the value for the specified key
+func (rc *redisCache) Set(key string, value []byte, ttl time.Duration) error {
+
+	args := []string{"SET", rc.prefix + key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	}
+
+	_, err := rc.do(rc.timeout, args...)
+	return err
+}
+
+// Ping sends a PING, within the deadline of ctx if it is sooner than
+// the timeout of the cache
+func (rc *redisCache) Ping(ctx context.Context) error {
+
+	timeout := rc.timeout
+	if deadline, ok := ctx.Deadline(); ok && (timeout <= 0 || time.Until(deadline) < timeout) {
+		timeout = time.Until(deadline)
+	}
+
+	reply, err := rc.do(timeout, "PING")
+	if err != nil {
+		return err
+	}
+
+	if reply != "PONG" {
+		return fmt.Errorf("redis: unexpected reply to PING: %v", reply)
+	}
+
+	return nil
+}
+
+// do sends a command and reads its reply within timeout. Connections
+// are returned to the pool only after a complete round trip.
+func (rc *redisCache) do(timeout time.Duration, args ...string) (interface{}, error) {
+
+	c, err := rc.get()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.do(timeout, args...)
+	if err != nil {
+		if _, ok := err.(redisError); !ok {
+			// Connection is in an unknown state
+			c.conn.Close()
+			return nil, err
+		}
+	}
+
+	rc.put(c)
+
+	return reply, err
+}
+
+func (rc *redisCache) get() (*redisConn, error) {
+
+	select {
+	case c := <-rc.pool:
+		return c, nil
+	default:
+	}
+
+	conn, err := net.DialTimeout("tcp", rc.addr, rc.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn)}
+
+	if rc.password != "" {
+		if _, err := c.do(rc.timeout, "AUTH", rc.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if rc.db != 0 {
+		if _, err := c.do(rc.timeout, "SELECT", strconv.Itoa(rc.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func (rc *redisCache) put(c *redisConn) {
+	select {
+	case rc.pool <- c:
+	default:
+		c.conn.Close()
+	}
+}
+
+func (c *redisConn) do(timeout time.Duration, args ...string) (interface{}, error) {
+
+	if timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	// Commands are sent as an array of bulk strings
+	cmd := make([]byte, 0, 64)
+	cmd = append(cmd, fmt.Sprintf("*%d\r\n", len(args))...)
+	for _, arg := range args {
+		cmd = append(cmd, fmt.Sprintf("$%d\r\n", len(arg))...)
+		cmd = append(cmd, arg...)
+		cmd = append(cmd, "\r\n"...)
+	}
+
+	if _, err := c.conn.Write(cmd); err != nil {
+		return nil, err
+	}
+
+	return c.readReply()
+}
+
+func (c *redisConn) readReply() (interface{}, error) {
+
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+
+	case '+': // Simple string
+		return line[1:], nil
+
+	case '-': // Error
+		return nil, redisError(line[1:])
+
+	case ':': // Integer
+		return strconv.ParseInt(line[1:], 10, 64)
+
+	case '$': // Bulk string
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+
+	case '*': // Array
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply: %q", line)
+	}
+}
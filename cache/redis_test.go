@@ -0,0 +1,460 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is an in-process server speaking enough of the Redis
+// protocol for redisCache: AUTH, SELECT, PING, GET and SET [PX ms]
+type fakeRedis struct {
+	listener net.Listener
+	password string
+
+	mutex   *sync.Mutex
+	values  map[string][]byte // Keys are "<db>/<key>"
+	expires map[string]time.Time
+	conns   int
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fr := &fakeRedis{
+		listener: listener,
+		password: password,
+		mutex:    &sync.Mutex{},
+		values:   make(map[string][]byte),
+		expires:  make(map[string]time.Time),
+	}
+
+	go fr.serve()
+
+	return fr
+}
+
+func (fr *fakeRedis) url(userinfo, db string) string {
+	return "redis://" + userinfo + fr.listener.Addr().String() + db
+}
+
+func (fr *fakeRedis) Close() {
+	fr.listener.Close()
+}
+
+func (fr *fakeRedis) serve() {
+	for {
+		conn, err := fr.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		fr.mutex.Lock()
+		fr.conns++
+		fr.mutex.Unlock()
+
+		go fr.handle(conn)
+	}
+}
+
+func (fr *fakeRedis) handle(conn net.Conn) {
+
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	authenticated := fr.password == ""
+	db := "0"
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		var reply string
+
+		switch cmd := strings.ToUpper(args[0]); {
+
+		case cmd == "AUTH":
+			if len(args) == 2 && args[1] == fr.password {
+				authenticated = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+
+		case cmd == "SELECT":
+			db = args[1]
+			reply = "+OK\r\n"
+
+		case cmd == "PING":
+			reply = "+PONG\r\n"
+
+		case cmd == "GET":
+			if value, ok := fr.get(db + "/" + args[1]); ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+			} else {
+				reply = "$-1\r\n"
+			}
+
+		case cmd == "SET":
+			var ttl time.Duration
+			if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+				ms, _ := strconv.Atoi(args[4])
+				ttl = time.Duration(ms) * time.Millisecond
+			}
+			fr.set(db+"/"+args[1], []byte(args[2]), ttl)
+			reply = "+OK\r\n"
+
+		default:
+			reply = "-ERR unknown command '" + args[0] + "'\r\n"
+		}
+
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (fr *fakeRedis) get(key string) ([]byte, bool) {
+
+	fr.mutex.Lock()
+	defer fr.mutex.Unlock()
+
+	if expires, ok := fr.expires[key]; ok && time.Now().After(expires) {
+		delete(fr.values, key)
+		delete(fr.expires, key)
+	}
+
+	value, ok := fr.values[key]
+	return value, ok
+}
+
+func (fr *fakeRedis) set(key string, value []byte, ttl time.Duration) {
+
+	fr.mutex.Lock()
+	defer fr.mutex.Unlock()
+
+	fr.values[key] = value
+	delete(fr.expires, key)
+	if ttl > 0 {
+		fr.expires[key] = time.Now().Add(ttl)
+	}
+}
+
+func (fr *fakeRedis) connections() int {
+	fr.mutex.Lock()
+	defer fr.mutex.Unlock()
+	return fr.conns
+}
+
+// readCommand reads an array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("expected array, got %q", line)
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("expected bulk string, got %q", line)
+		}
+
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+
+	return args, nil
+}
+
+func TestRedisGetSet(t *testing.T) {
+
+	server := newFakeRedis(t, "")
+	defer server.Close()
+
+	c, err := NewRedis(server.url("", ""), "test:", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Get("missing"); err != ErrMiss {
+		t.Errorf("Get(missing) error = %v, want ErrMiss", err)
+	}
+
+	// Values are binary safe, including CRLF
+	value := []byte("line 1\r\nline 2\x00")
+	if err := c.Set("key", value, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.Get("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, value) {
+		t.Errorf("Get(key) = %q, want %q", got, value)
+	}
+
+	if _, ok := server.get("0/test:key"); !ok {
+		t.Error("key is not stored with the prefix")
+	}
+
+	// Connections are reused
+	if n := server.connections(); n != 1 {
+		t.Errorf("%d connections, want 1", n)
+	}
+}
+
+func TestRedisTTL(t *testing.T) {
+
+	server := newFakeRedis(t, "")
+	defer server.Close()
+
+	c, err := NewRedis(server.url("", ""), "", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Set("key", []byte("value"), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Get("key"); err != nil {
+		t.Fatalf("Get before expiration: %v", err)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+
+	if _, err := c.Get("key"); err != ErrMiss {
+		t.Errorf("Get after expiration error = %v, want ErrMiss", err)
+	}
+}
+
+func TestRedisAuthAndSelect(t *testing.T) {
+
+	server := newFakeRedis(t, "s3cret")
+	defer server.Close()
+
+	c, err := NewRedis(server.url(":s3cret@", "/2"), "", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Set("key", []byte("value"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := server.get("2/key"); !ok {
+		t.Error("key is not stored in database 2")
+	}
+
+	wrong, err := NewRedis(server.url(":wrong@", ""), "", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wrong.Close()
+
+	if _, err := wrong.Get("key"); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("Get with a wrong password error = %v, want WRONGPASS", err)
+	}
+
+	anonymous, err := NewRedis(server.url("", ""), "", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer anonymous.Close()
+
+	if _, err := anonymous.Get("key"); err == nil || !strings.Contains(err.Error(), "NOAUTH") {
+		t.Errorf("Get without a password error = %v, want NOAUTH", err)
+	}
+}
+
+func TestRedisErrorReplyKeepsConnection(t *testing.T) {
+
+	server := newFakeRedis(t, "")
+	defer server.Close()
+
+	c, err := NewRedis(server.url("", ""), "", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	rc := c.(*redisCache)
+
+	if _, err := rc.do(rc.timeout, "FLUSHALL"); err == nil {
+		t.Fatal("unknown command succeeded")
+	} else if _, ok := err.(redisError); !ok {
+		t.Fatalf("error = %T, want redisError", err)
+	}
+
+	// The connection is still in sync after an error reply
+	if err := c.Set("key", []byte("value"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if n := server.connections(); n != 1 {
+		t.Errorf("%d connections, want 1", n)
+	}
+}
+
+func TestRedisUnreachable(t *testing.T) {
+
+	server := newFakeRedis(t, "")
+	url := server.url("", "")
+	server.Close()
+
+	c, err := NewRedis(url, "", 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Get("key"); err == nil || err == ErrMiss {
+		t.Errorf("Get error = %v, want a connection error", err)
+	}
+}
+
+func TestRedisPing(t *testing.T) {
+
+	server := newFakeRedis(t, "s3cr3t")
+	defer server.Close()
+
+	c, err := NewRedis(server.url(":s3cr3t@", ""), "", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.(Pinger).Ping(context.Background()); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+
+	server.Close()
+	c.Close()
+
+	if err := c.(Pinger).Ping(context.Background()); err == nil {
+		t.Error("Ping of a stopped server succeeded")
+	}
+}
+
+func TestNewRedisURL(t *testing.T) {
+
+	tests := []struct {
+		url      string
+		addr     string
+		password string
+		db       int
+		err      bool
+	}{
+		{url: "redis://localhost", addr: "localhost:6379"},
+		{url: "redis://cache:6380", addr: "cache:6380"},
+		{url: "redis://:pass@cache:6379/3", addr: "cache:6379", password: "pass", db: 3},
+		{url: "redis://cache/", addr: "cache:6379"},
+		{url: "http://cache:6379", err: true},
+		{url: "redis://cache:6379/db", err: true},
+		{url: "://", err: true},
+	}
+
+	for _, test := range tests {
+		c, err := NewRedis(test.url, "", time.Second)
+		if test.err {
+			if err == nil {
+				t.Errorf("NewRedis(%q) succeeded, want an error", test.url)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewRedis(%q) error = %v", test.url, err)
+			continue
+		}
+
+		rc := c.(*redisCache)
+		if rc.addr != test.addr || rc.password != test.password || rc.db != test.db {
+			t.Errorf("NewRedis(%q) = %s %q %d, want %s %q %d",
+				test.url, rc.addr, rc.password, rc.db, test.addr, test.password, test.db)
+		}
+	}
+}
+
+func TestReadReply(t *testing.T) {
+
+	tests := []struct {
+		input string
+		want  interface{}
+		err   bool
+	}{
+		{input: "+OK\r\n", want: "OK"},
+		{input: ":42\r\n", want: int64(42)},
+		{input: "$5\r\nhello\r\n", want: []byte("hello")},
+		{input: "$0\r\n\r\n", want: []byte{}},
+		{input: "$-1\r\n", want: nil},
+		{input: "*2\r\n$1\r\na\r\n:1\r\n", want: []interface{}{[]byte("a"), int64(1)}},
+		{input: "*-1\r\n", want: nil},
+		{input: "-ERR wrong type\r\n", err: true},
+		{input: "\r\n", err: true},
+		{input: "?what\r\n", err: true},
+		{input: "$5\r\nhi\r\n", err: true},
+		{input: ":x\r\n", err: true},
+	}
+
+	for _, test := range tests {
+		c := &redisConn{r: bufio.NewReader(strings.NewReader(test.input))}
+
+		reply, err := c.readReply()
+		if test.err {
+			if err == nil {
+				t.Errorf("readReply(%q) = %#v, want an error", test.input, reply)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("readReply(%q) error = %v", test.input, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(reply, test.want) {
+			t.Errorf("readReply(%q) = %#v, want %#v", test.input, reply, test.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package catalogue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/discovery"
+	"github.com/nimbo-stratuz/bikeshare-directions/models"
+	"github.com/nimbo-stratuz/bikeshare-directions/tracing"
+	"github.com/nimbo-stratuz/bikeshare-directions/upstream"
+)
+
+// Client is an interface for the bikeshare-catalogue service
+type Client interface {
+	// ClosestBicycle finds the bicycle closest to the specified location
+	ClosestBicycle(ctx context.Context, requestID string, lat, lng float64) (*models.Bicycle, error)
+}
+
+type client struct {
+	discovery discovery.ServiceDiscovery
+	env       string
+
+	http *upstream.Client
+}
+
+const (
+	serviceName    = "bikeshare-catalogue"
+	serviceVersion = "1.0.0"
+)
+
+// New creates a Client that discovers bikeshare-catalogue instances
+// in the specified environment
+func New(d discovery.ServiceDiscovery, env string, httpClient *upstream.Client) Client {
+	return &client{
+		discovery: d,
+		env:       env,
+		http:      httpClient,
+	}
+}
+
+func (c *client) ClosestBicycle(ctx context.Context, requestID string, lat, lng float64) (*models.Bicycle, error) {
+
+	ctx, span := tracing.StartSpan(ctx, "catalogue.ClosestBicycle", tracing.KindInternal)
+	defer span.End()
+
+	bicycle, err := c.closestBicycle(ctx, requestID, lat, lng)
+	if _, ok := err.(*NoBicycleError); ok {
+		span.SetAttribute("bicycle.available", false)
+	} else if err != nil {
+		span.SetError(err)
+	} else {
+		span.SetAttribute("bicycle.id", bicycle.ID)
+	}
+
+	return bicycle, err
+}
+
+func (c *client) closestBicycle(ctx context.Context, requestID string, lat, lng float64) (*models.Bicycle, error) {
+
+	catalogueURLString, err := Discover(ctx, c.discovery, c.env)
+	if err != nil {
+		return nil, err
+	}
+
+	catalogueURL, err := url.Parse(catalogueURLString + "/v1/bicycles")
+	if err != nil {
+		return nil, err
+	}
+
+	query := catalogueURL.Query()
+
+	query.Set("latitude", fmt.Sprint(lat))
+	query.Set("longitude", fmt.Sprint(lng))
+
+	catalogueURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest("GET", catalogueURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-Request-ID", requestID)
+
+	resp, err := c.http.Do(ctx, req)
+	if err != nil {
+		return nil, NewUnavailableError(upstream.StripURL(err).Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, NewNoBicycleError("No bicycle registered near the location")
+	} else if resp.StatusCode >= 500 {
+		return nil, NewUnavailableError(resp.Status)
+	} else if resp.StatusCode >= 300 {
+		return nil, NewRejectedError(resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, NewUnavailableError("response/Read: " + err.Error())
+	}
+
+	return decodeBicycle(body)
+}
+
+// Discover finds the URL of a bikeshare-catalogue instance
+// in the specified environment
+func Discover(ctx context.Context, d discovery.ServiceDiscovery, env string) (string, error) {
+	return d.Discover(ctx, serviceName, env, serviceVersion)
+}
+
+// decodeBicycle decodes a bicycle or a list of bicycles (closest first).
+// An empty response, an empty list or an empty object mean there is
+// no bicycle available.
+func decodeBicycle(body []byte) (*models.Bicycle, error) {
+
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || bytes.Equal(body, []byte("null")) {
+		return nil, NewNoBicycleError("No bicycle available near the location")
+	}
+
+	bicycle := &models.Bicycle{}
+
+	if body[0] == '[' {
+		var bicycles []*models.Bicycle
+		if err := json.Unmarshal(body, &bicycles); err != nil {
+			return nil, NewUnavailableError("response/Decode: " + err.Error())
+		}
+		if len(bicycles) == 0 || bicycles[0] == nil {
+			return nil, NewNoBicycleError("No bicycle available near the location")
+		}
+		bicycle = bicycles[0]
+	} else if err := json.Unmarshal(body, bicycle); err != nil {
+		return nil, NewUnavailableError("response/Decode: " + err.Error())
+	}
+
+	if bicycle.ID == 0 {
+		return nil, NewNoBicycleError("No bicycle available near the location")
+	}
+
+	return bicycle, nil
+}
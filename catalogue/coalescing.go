@@ -0,0 +1,40 @@
+package catalogue
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/coalesce"
+	"github.com/nimbo-stratuz/bikeshare-directions/models"
+)
+
+// coalescing is a Client that shares a single upstream request
+// between identical concurrent calls
+type coalescing struct {
+	client Client
+	group  *coalesce.Group
+}
+
+// NewCoalescing creates a Client that coalesces identical concurrent
+// ClosestBicycle calls to client. Coalesced calls are sent with the
+// request ID of the first caller.
+func NewCoalescing(client Client) Client {
+	return &coalescing{
+		client: client,
+		group:  coalesce.NewGroup("catalogue"),
+	}
+}
+
+func (c *coalescing) ClosestBicycle(ctx context.Context, requestID string, lat, lng float64) (*models.Bicycle, error) {
+
+	key := fmt.Sprintf("%f,%f", lat, lng)
+
+	value, err, _ := c.group.Do(ctx, key, func(ctx context.Context) (interface{}, error) {
+		return c.client.ClosestBicycle(ctx, requestID, lat, lng)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.(*models.Bicycle), nil
+}
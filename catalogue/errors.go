@@ -0,0 +1,53 @@
+package catalogue
+
+import "fmt"
+
+// UnavailableError is returned when bikeshare-catalogue cannot be
+// reached, fails or its response cannot be read
+type UnavailableError struct {
+	reason string
+}
+
+// NewUnavailableError creates a new UnavailableError
+func NewUnavailableError(reason string) *UnavailableError {
+	return &UnavailableError{reason}
+}
+
+func (ue *UnavailableError) Error() string {
+	return fmt.Sprintf("Catalogue unavailable: %s", ue.reason)
+}
+
+// RejectedError is returned when bikeshare-catalogue
+// rejects a request with a client error status
+type RejectedError struct {
+	StatusCode int
+}
+
+// NewRejectedError creates a new RejectedError
+func NewRejectedError(statusCode int) *RejectedError {
+	return &RejectedError{statusCode}
+}
+
+func (re *RejectedError) Error() string {
+	return fmt.Sprintf("Catalogue rejected the request: status %d", re.StatusCode)
+}
+
+// NoBicycleError is returned when bikeshare-catalogue has no bicycle
+// available near the requested location
+type NoBicycleError struct {
+	reason string
+}
+
+// NewNoBicycleError creates a new NoBicycleError
+func NewNoBicycleError(reason string) *NoBicycleError {
+	return &NoBicycleError{reason}
+}
+
+// Reason explains why there is no bicycle
+func (nbe *NoBicycleError) Reason() string {
+	return nbe.reason
+}
+
+func (nbe *NoBicycleError) Error() string {
+	return fmt.Sprintf("No bicycle available: %s", nbe.reason)
+}
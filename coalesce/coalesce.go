@@ -0,0 +1,152 @@
+package coalesce
+
+import (
+	"context"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/metrics"
+)
+
+// Group coalesces concurrent calls with the same key into a single
+// call, whose result is shared by all callers
+type Group struct {
+	mutex *sync.Mutex
+	calls map[string]*call
+
+	name  string
+	stats *expvar.Map
+}
+
+var groupCalls = metrics.NewCounter(
+	"coalesce_calls_total",
+	"Number of upstream lookups by coalescing group and result (executed, coalesced).",
+	"group", "result",
+)
+
+type call struct {
+	done  chan struct{} // Closed when the call completes
+	value interface{}
+	err   error
+}
+
+// statsMutex serializes publishing of expvars, which panics on
+// duplicate names
+var statsMutex = &sync.Mutex{}
+
+// NewGroup creates a Group. Number of calls made and coalesced are
+// published as expvar "coalesce.<name>", shared by groups with the
+// same name (e.g. a provider recreated after a config change).
+func NewGroup(name string) *Group {
+
+	return &Group{
+		mutex: &sync.Mutex{},
+		calls: make(map[string]*call),
+		name:  name,
+		stats: publishStats("coalesce." + name),
+	}
+}
+
+// publishStats returns the expvar map published as name, publishing it
+// if needed
+func publishStats(name string) *expvar.Map {
+
+	statsMutex.Lock()
+	defer statsMutex.Unlock()
+
+	if stats, ok := expvar.Get(name).(*expvar.Map); ok {
+		return stats
+	}
+
+	stats := new(expvar.Map).Init()
+	expvar.Publish(name, stats)
+
+	return stats
+}
+
+// Do executes fn, unless a call with the same key is already in flight.
+// In that case, it waits for that call and returns its result.
+// shared reports whether the result was shared with other callers.
+//
+// fn runs with a context that keeps the values and deadline of ctx, but is
+// not canceled with it, so one caller going away does not fail the others.
+// A caller whose ctx is done stops waiting and gets ctx.Err().
+func (g *Group) Do(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (value interface{}, err error, shared bool) {
+
+	g.mutex.Lock()
+	c, shared := g.calls[key]
+	if !shared {
+		c = &call{done: make(chan struct{})}
+		g.calls[key] = c
+	}
+	g.mutex.Unlock()
+
+	if shared {
+		g.stats.Add("coalesced", 1)
+		groupCalls.Inc(g.name, "coalesced")
+	} else {
+		g.stats.Add("calls", 1)
+		groupCalls.Inc(g.name, "executed")
+		go g.run(ctx, key, c, fn)
+	}
+
+	select {
+	case <-c.done:
+		return c.value, c.err, shared
+	case <-ctx.Done():
+		return nil, ctx.Err(), shared
+	}
+}
+
+func (g *Group) run(ctx context.Context, key string, c *call, fn func(context.Context) (interface{}, error)) {
+
+	callCtx, cancel := detach(ctx)
+	defer cancel()
+
+	defer func() {
+		g.mutex.Lock()
+		delete(g.calls, key)
+		g.mutex.Unlock()
+		close(c.done)
+	}()
+
+	c.value, c.err = fn(callCtx)
+}
+
+// Stats returns the number of calls executed and the number of calls
+// that were coalesced into another call
+func (g *Group) Stats() (calls, coalesced int64) {
+
+	if v, ok := g.stats.Get("calls").(*expvar.Int); ok {
+		calls = v.Value()
+	}
+
+	if v, ok := g.stats.Get("coalesced").(*expvar.Int); ok {
+		coalesced = v.Value()
+	}
+
+	return calls, coalesced
+}
+
+// detachedContext carries the values of its parent, but not its
+// cancellation
+type detachedContext struct {
+	parent context.Context
+}
+
+func (dc detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (dc detachedContext) Done() <-chan struct{}             { return nil }
+func (dc detachedContext) Err() error                        { return nil }
+func (dc detachedContext) Value(key interface{}) interface{} { return dc.parent.Value(key) }
+
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+
+	detached := context.Context(detachedContext{ctx})
+
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(detached, deadline)
+	}
+
+	return context.WithCancel(detached)
+}
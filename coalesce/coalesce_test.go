@@ -0,0 +1,208 @@
+package coalesce
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type contextKey string
+
+// waitFor polls cond for up to a second
+func waitFor(t *testing.T, cond func() bool) {
+
+	t.Helper()
+
+	for deadline := time.Now().Add(time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDoCoalesces(t *testing.T) {
+
+	// Stats are global and survive repeated runs (-count)
+	g := NewGroup(t.Name())
+	calls0, coalesced0 := g.Stats()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	executions := 0
+
+	fn := func(ctx context.Context) (interface{}, error) {
+		executions++
+		close(started)
+		<-release
+		return "value", nil
+	}
+
+	const callers = 5
+
+	var wg sync.WaitGroup
+	values := make([]interface{}, callers)
+	shared := make([]bool, callers)
+
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			values[i], _, shared[i] = g.Do(context.Background(), "key", fn)
+		}(i)
+
+		if i == 0 {
+			<-started
+		}
+	}
+
+	waitFor(t, func() bool {
+		_, coalesced := g.Stats()
+		return coalesced-coalesced0 == callers-1
+	})
+	close(release)
+	wg.Wait()
+
+	if executions != 1 {
+		t.Errorf("fn executed %d times, want 1", executions)
+	}
+
+	sharedCount := 0
+	for i := range values {
+		if values[i] != "value" {
+			t.Errorf("caller %d got %v", i, values[i])
+		}
+		if shared[i] {
+			sharedCount++
+		}
+	}
+	if sharedCount != callers-1 {
+		t.Errorf("%d shared results, want %d", sharedCount, callers-1)
+	}
+
+	if calls, coalesced := g.Stats(); calls-calls0 != 1 || coalesced-coalesced0 != callers-1 {
+		t.Errorf("Stats() increased by %d, %d, want 1, %d", calls-calls0, coalesced-coalesced0, callers-1)
+	}
+
+	// Completed calls are not cached
+	if _, _, shared := g.Do(context.Background(), "key", func(context.Context) (interface{}, error) {
+		return "again", nil
+	}); shared {
+		t.Error("call after completion was coalesced")
+	}
+}
+
+func TestDoDifferentKeys(t *testing.T) {
+
+	g := NewGroup(t.Name())
+
+	for _, key := range []string{"a", "b"} {
+		value, err, shared := g.Do(context.Background(), key, func(context.Context) (interface{}, error) {
+			return key, nil
+		})
+		if value != key || err != nil || shared {
+			t.Errorf("Do(%s) = %v, %v, %v", key, value, err, shared)
+		}
+	}
+}
+
+func TestDoError(t *testing.T) {
+
+	g := NewGroup(t.Name())
+	want := errors.New("upstream failed")
+
+	_, err, _ := g.Do(context.Background(), "key", func(context.Context) (interface{}, error) {
+		return nil, want
+	})
+	if err != want {
+		t.Errorf("Do() error = %v, want %v", err, want)
+	}
+}
+
+func TestDoCallerCanceled(t *testing.T) {
+
+	g := NewGroup(t.Name())
+	_, coalesced0 := g.Stats()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fnErr := make(chan error, 1)
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), contextKey("id"), "42"))
+
+	fn := func(ctx context.Context) (interface{}, error) {
+		if ctx.Value(contextKey("id")) != "42" {
+			t.Error("context values are not kept")
+		}
+		close(started)
+		<-release
+		fnErr <- ctx.Err()
+		return "value", nil
+	}
+
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err, _ := g.Do(ctx, "key", fn)
+		firstErr <- err
+	}()
+	<-started
+
+	second := make(chan interface{}, 1)
+	go func() {
+		value, _, _ := g.Do(context.Background(), "key", fn)
+		second <- value
+	}()
+	waitFor(t, func() bool {
+		_, coalesced := g.Stats()
+		return coalesced-coalesced0 == 1
+	})
+
+	// The first caller goes away, the call keeps running for the second
+	cancel()
+	if err := <-firstErr; err != context.Canceled {
+		t.Errorf("canceled caller error = %v, want context.Canceled", err)
+	}
+
+	close(release)
+
+	if err := <-fnErr; err != nil {
+		t.Errorf("fn context error = %v, want nil", err)
+	}
+	if value := <-second; value != "value" {
+		t.Errorf("second caller got %v", value)
+	}
+}
+
+func TestDoKeepsDeadline(t *testing.T) {
+
+	g := NewGroup(t.Name())
+
+	want := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), want)
+	defer cancel()
+
+	g.Do(ctx, "key", func(ctx context.Context) (interface{}, error) {
+		if deadline, ok := ctx.Deadline(); !ok || !deadline.Equal(want) {
+			t.Errorf("Deadline() = %v, %v, want %v", deadline, ok, want)
+		}
+		return nil, nil
+	})
+}
+
+func TestNewGroupSameName(t *testing.T) {
+
+	first := NewGroup(t.Name())
+	first.Do(context.Background(), "key", func(context.Context) (interface{}, error) {
+		return nil, nil
+	})
+
+	// Publishing the same expvar twice must not panic
+	second := NewGroup(t.Name())
+
+	calls, _ := first.Stats()
+	if secondCalls, _ := second.Stats(); secondCalls != calls {
+		t.Errorf("second group has %d calls, want the %d of the first", secondCalls, calls)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/config"
+	"github.com/nimbo-stratuz/bikeshare-directions/service"
+)
+
+const usage = `Usage:
+  bikeshare-directions                               Start the server
+  bikeshare-directions config get [-secrets] <key>   Print the effective value of key
+  bikeshare-directions config set <key> <value>      Write key to etcd
+  bikeshare-directions config dump [-secrets]        Print all keys with their value and source
+  bikeshare-directions config validate               Check the config against the schema
+
+Keys are dotted, e.g. maps.api.key. Config is read from the same sources
+as the server (env, secret files, etcd, config.yaml). Secrets are redacted
+unless -secrets is set.
+`
+
+// runCommand runs the subcommand in args and returns the exit code
+func runCommand(args []string, stdout, stderr io.Writer) int {
+
+	if len(args) < 2 || args[0] != "config" {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet(args[0]+" "+args[1], flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	showSecrets := flags.Bool("secrets", false, "Print secret values")
+
+	if err := flags.Parse(args[2:]); err != nil {
+		return 2
+	}
+
+	// Keep the output of commands clean
+	service.InitConfig()
+	log.SetLevel(log.WarnLevel)
+	defer service.Config.Close()
+
+	switch args[1] {
+
+	case "get":
+		if flags.NArg() != 1 {
+			break
+		}
+
+		entry := service.DescribeConfig(flags.Arg(0), *showSecrets)
+		if entry.Source == "" {
+			fmt.Fprintf(stderr, "%s is not set\n", entry.Key)
+			return 1
+		}
+
+		fmt.Fprintln(stdout, entry.Value)
+		return 0
+
+	case "set":
+		if flags.NArg() != 2 {
+			break
+		}
+
+		if err := service.SetConfig(flags.Arg(0), flags.Arg(1)); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+
+		entry := service.DescribeConfig(flags.Arg(0), false)
+		fmt.Fprintf(stdout, "%s = %s (%s)\n", entry.Key, entry.Value, entry.Source)
+		return 0
+
+	case "dump":
+		if flags.NArg() != 0 {
+			break
+		}
+
+		tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+
+		for _, field := range service.ConfigSchema() {
+			entry := service.DescribeConfig(field.Key, *showSecrets)
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", entry.Key, entry.Value, entry.Source)
+		}
+
+		tw.Flush()
+		return 0
+
+	case "validate":
+		if flags.NArg() != 0 {
+			break
+		}
+
+		err := service.ConfigSchema().Validate(service.Config)
+		if verr, ok := err.(*config.ValidationError); ok {
+			for _, problem := range verr.Problems {
+				fmt.Fprintf(stderr, "%s: %s\n", problem.Key, problem.Message)
+			}
+			return 1
+		} else if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+
+		fmt.Fprintln(stdout, "Config is valid")
+		return 0
+	}
+
+	fmt.Fprint(stderr, usage)
+	return 2
+}
@@ -1,11 +1,16 @@
 package config
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/logging"
 )
 
 // Config is a common interface that ensures basic methods
@@ -13,6 +18,15 @@ type Config interface {
 	Close() error
 	Get(...string) (string, error)
 	GetInt(...string) (int, error)
+	GetBool(...string) (bool, error)
+	GetFloat(...string) (float64, error)
+	GetDuration(...string) (time.Duration, error) // "1.5s", "300ms" or milliseconds
+	GetStringSlice(...string) ([]string, error)   // YAML list or comma-separated
+	Decode(prefix string, v interface{}) error    // Bind the subtree under prefix to a struct
+
+	// Watch calls fn with the old and new value when the value of key
+	// (e.g. "maps.api.key") changes. fn is called from a separate goroutine.
+	Watch(key string, fn func(old, new string))
 }
 
 // WritableConfig is an editable config source (supports method Put)
@@ -21,6 +35,30 @@ type WritableConfig interface {
 	Put(string, interface{}) (interface{}, error)
 }
 
+// Counter is a config source with integer counters shared between
+// instances of all versions (supports methods Count and Add). Counters
+// are read and written directly, without watches or caching.
+type Counter interface {
+	Count(key string) (int, error)          // Current value of the counter key (e.g. "quota/mapquest/2019-01"), 0 if not set
+	Add(key string, delta int) (int, error) // Atomically add delta to the counter key, returning the new value
+}
+
+// Pinger is a config source backed by a remote service
+// (supports method Ping)
+type Pinger interface {
+	Ping(ctx context.Context) error // Check that the service is reachable
+}
+
+// Named is a config source with a name (e.g. "env", "etcd", "yaml")
+type Named interface {
+	Name() string
+}
+
+// Sourced is a Config that can tell which source provides a key
+type Sourced interface {
+	Source(key ...string) (string, error) // Name of the source of the effective value of key
+}
+
 // multiConfig represents a hierarchy of Configs
 type multiConfig struct {
 	configs []Config
@@ -61,33 +99,167 @@ func (mc *multiConfig) Close() error {
 // Get returns a string value for the specified key
 func (mc *multiConfig) Get(key ...string) (string, error) {
 
-	var errs []string
+	var value string
+	err := mc.lookup(key, func(c Config) (err error) {
+		value, err = c.Get(key...)
+		return
+	})
+
+	return value, err
+}
+
+// GetInt returns an int value for the specified key
+func (mc *multiConfig) GetInt(key ...string) (int, error) {
+
+	var value int
+	err := mc.lookup(key, func(c Config) (err error) {
+		value, err = c.GetInt(key...)
+		return
+	})
+
+	return value, err
+}
+
+// GetBool returns a bool value for the specified key
+func (mc *multiConfig) GetBool(key ...string) (bool, error) {
+
+	var value bool
+	err := mc.lookup(key, func(c Config) (err error) {
+		value, err = c.GetBool(key...)
+		return
+	})
+
+	return value, err
+}
+
+// GetFloat returns a float value for the specified key
+func (mc *multiConfig) GetFloat(key ...string) (float64, error) {
+
+	var value float64
+	err := mc.lookup(key, func(c Config) (err error) {
+		value, err = c.GetFloat(key...)
+		return
+	})
+
+	return value, err
+}
+
+// GetDuration returns a duration for the specified key
+func (mc *multiConfig) GetDuration(key ...string) (time.Duration, error) {
+
+	var value time.Duration
+	err := mc.lookup(key, func(c Config) (err error) {
+		value, err = c.GetDuration(key...)
+		return
+	})
+
+	return value, err
+}
+
+// GetStringSlice returns a list of strings for the specified key
+func (mc *multiConfig) GetStringSlice(key ...string) ([]string, error) {
+
+	var value []string
+	err := mc.lookup(key, func(c Config) (err error) {
+		value, err = c.GetStringSlice(key...)
+		return
+	})
+
+	return value, err
+}
+
+// Decode binds the subtree under prefix to a struct. Each field is
+// looked up separately, so fields may come from different Configs.
+func (mc *multiConfig) Decode(prefix string, v interface{}) error {
+	return decode(mc, prefix, v)
+}
+
+// Watch calls fn when the effective value of key changes: a change in
+// a Config is ignored while a Config of higher priority has the key.
+func (mc *multiConfig) Watch(key string, fn func(old, new string)) {
+
+	path := strings.Split(key, ".")
+
+	mutex := &sync.Mutex{}
+	current, _ := mc.Get(path...)
 
 	for _, c := range mc.configs {
-		value, err := c.Get(key...)
-		if err == nil {
-			// key found
-			return value, nil
+		c.Watch(key, func(_, _ string) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			// The change may be masked, or reveal a lower priority value
+			value, _ := mc.Get(path...)
+			if value == current {
+				return
+			}
+
+			old := current
+			current = value
+			fn(old, value)
+		})
+	}
+}
+
+// Source returns the name of the Config of highest priority that has
+// the key, which provides its effective value
+func (mc *multiConfig) Source(key ...string) (string, error) {
+
+	for _, c := range mc.configs {
+		if _, err := c.Get(key...); err == nil {
+			return sourceName(c), nil
 		}
-		errs = append(errs, err.Error())
 	}
 
-	return "", fmt.Errorf("Key not found: %s | Errors: [%s]", strings.Join(key, "."), strings.Join(errs, "; "))
+	return "", fmt.Errorf("Key not found: %s", strings.Join(key, "."))
 }
 
-// GetInt returns an int value for the specified key
-func (mc *multiConfig) GetInt(key ...string) (int, error) {
+func sourceName(c Config) string {
+
+	if named, ok := c.(Named); ok {
+		return named.Name()
+	}
+
+	return fmt.Sprintf("%T", c)
+}
+
+// lookup calls get with the Config of highest priority that has the key.
+// An invalid value is an error, rather than hidden by lower priorities.
+// Encrypted values are decrypted, and secrets are redacted in errors.
+func (mc *multiConfig) lookup(key []string, get func(c Config) error) error {
+
+	fullKey := strings.Join(key, ".")
 
 	var errs []string
 
 	for _, c := range mc.configs {
-		value, err := c.GetInt(key...)
-		if err == nil {
-			// key found
-			return value, nil
+		value, err := c.Get(key...)
+		if err != nil {
+			errs = append(errs, logging.Redact(err.Error()))
+			continue
 		}
-		errs = append(errs, err.Error())
+
+		// key found
+		if isSecretKey(fullKey) {
+			logging.SetSecret(sourceName(c)+":"+fullKey, value)
+		}
+
+		if strings.HasPrefix(value, EncryptedPrefix) {
+			plain, err := decrypt(value)
+			if err != nil {
+				return fmt.Errorf("%s: %s", fullKey, err)
+			}
+			logging.SetSecret(sourceName(c)+":"+fullKey+":decrypted", plain)
+
+			c = defaultConfig(plain)
+		}
+
+		if err := get(c); err != nil {
+			return errors.New(logging.Redact(err.Error()))
+		}
+
+		return nil
 	}
 
-	return 0, fmt.Errorf("Key not found: %s | Errors: [%s]", strings.Join(key, "."), strings.Join(errs, "; "))
+	return fmt.Errorf("Key not found: %s | Errors: [%s]", fullKey, strings.Join(errs, "; "))
 }
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LoadDotEnv sets the environment variables in a .env file, for local
+// development. Variables already set in the environment are not changed.
+// Lines are KEY=VALUE, optionally preceded by "export". Values can be
+// quoted, with escapes (\n, \") in double quotes. Blank lines and lines
+// starting with # are skipped.
+func LoadDotEnv(path string) error {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+
+		name, value, ok, err := parseDotEnvLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s", path, lineNumber, err)
+		} else if !ok {
+			continue
+		}
+
+		if _, set := os.LookupEnv(name); set {
+			continue
+		}
+
+		if err := os.Setenv(name, value); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// parseDotEnvLine returns the variable of a line of a .env file,
+// ok is false for blank lines and comments
+func parseDotEnvLine(line string) (name, value string, ok bool, err error) {
+
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false, nil
+	}
+
+	line = strings.TrimPrefix(line, "export ")
+
+	i := strings.Index(line, "=")
+	if i < 0 {
+		return "", "", false, fmt.Errorf("Expected NAME=VALUE")
+	}
+
+	name = strings.TrimSpace(line[:i])
+	value = strings.TrimSpace(line[i+1:])
+
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return "", "", false, fmt.Errorf("Invalid name: %q", name)
+	}
+
+	switch {
+
+	case strings.HasPrefix(value, `"`):
+		end := closingQuote(value)
+		if end < 0 {
+			return "", "", false, fmt.Errorf("Unterminated quote in %s", name)
+		}
+		if value, err = strconv.Unquote(value[:end+1]); err != nil {
+			return "", "", false, fmt.Errorf("Invalid value of %s: %s", name, err)
+		}
+
+	case strings.HasPrefix(value, "'"):
+		end := strings.Index(value[1:], "'")
+		if end < 0 {
+			return "", "", false, fmt.Errorf("Unterminated quote in %s", name)
+		}
+		value = value[1 : end+1]
+
+	default:
+		// Comments after unquoted values, e.g. PORT=8088 # local
+		if j := strings.Index(value, " #"); j >= 0 {
+			value = strings.TrimSpace(value[:j])
+		}
+	}
+
+	return name, value, true, nil
+}
+
+// closingQuote returns the index of the double quote closing value,
+// or -1
+func closingQuote(value string) int {
+
+	for i := 1; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+
+	return -1
+}
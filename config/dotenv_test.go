@@ -0,0 +1,49 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestParseDotEnvLine(t *testing.T) {
+
+	tests := []struct {
+		line  string
+		name  string
+		value string
+		ok    bool
+		err   bool
+	}{
+		{line: "", ok: false},
+		{line: "   ", ok: false},
+		{line: "# MAPS_API_KEY=abc", ok: false},
+		{line: "MAPS_API_KEY=abc", name: "MAPS_API_KEY", value: "abc", ok: true},
+		{line: "  MAPS_API_KEY = abc  ", name: "MAPS_API_KEY", value: "abc", ok: true},
+		{line: "export MAPS_API_KEY=abc", name: "MAPS_API_KEY", value: "abc", ok: true},
+		{line: "EMPTY=", name: "EMPTY", value: "", ok: true},
+		{line: "URL=http://localhost:2379?a=b", name: "URL", value: "http://localhost:2379?a=b", ok: true},
+		{line: "PORT=8088 # local", name: "PORT", value: "8088", ok: true},
+		{line: "COLOR=#fff", name: "COLOR", value: "#fff", ok: true},
+		{line: `GREETING="hello # world"`, name: "GREETING", value: "hello # world", ok: true},
+		{line: `GREETING="say \"hi\"\n" # comment`, name: "GREETING", value: "say \"hi\"\n", ok: true},
+		{line: `RAW='a \n "b"' # comment`, name: "RAW", value: `a \n "b"`, ok: true},
+		{line: "MAPS_API_KEY", err: true},
+		{line: "=abc", err: true},
+		{line: "MAPS API KEY=abc", err: true},
+		{line: `GREETING="hello`, err: true},
+		{line: `RAW='hello`, err: true},
+		{line: `GREETING="\q"`, err: true},
+	}
+
+	for _, test := range tests {
+		name, value, ok, err := parseDotEnvLine(test.line)
+
+		if (err != nil) != test.err {
+			t.Errorf("parseDotEnvLine(%q) error = %v, want error %t", test.line, err, test.err)
+			continue
+		}
+		if name != test.name || value != test.value || ok != test.ok {
+			t.Errorf("parseDotEnvLine(%q) = %q, %q, %t, want %q, %q, %t",
+				test.line, name, value, ok, test.name, test.value, test.ok)
+		}
+	}
+}
@@ -5,15 +5,29 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // envConfig is a client for reading env variables
 type envConfig struct {
+	prefix string
 }
 
-// NewEnvConfig New creates an envConfig instance
-func NewEnvConfig() Config {
-	return &envConfig{}
+// NewEnvConfig New creates an envConfig instance. Variables are named
+// like keys, with a prefix (e.g. BIKESHARE_DIRECTIONS_), so that
+// maps.api.key is read from BIKESHARE_DIRECTIONS_MAPS_API_KEY.
+func NewEnvConfig(prefix string) Config {
+
+	if prefix != "" && !strings.HasSuffix(prefix, "_") {
+		prefix += "_"
+	}
+
+	return &envConfig{prefix: strings.ToUpper(prefix)}
+}
+
+// Name of the source
+func (ec *envConfig) Name() string {
+	return "env"
 }
 
 // Close does nothing for envConfig
@@ -48,15 +62,72 @@ func (ec *envConfig) GetInt(key ...string) (int, error) {
 	return int(intValue), nil
 }
 
+// GetBool returns a string for the specified key converted to a bool
+func (ec *envConfig) GetBool(key ...string) (bool, error) {
+	return getBool(ec, key...)
+}
+
+// GetFloat returns a string for the specified key converted to a float
+func (ec *envConfig) GetFloat(key ...string) (float64, error) {
+	return getFloat(ec, key...)
+}
+
+// GetDuration returns a string for the specified key converted to a duration
+func (ec *envConfig) GetDuration(key ...string) (time.Duration, error) {
+	return getDuration(ec, key...)
+}
+
+// GetStringSlice returns a comma-separated string for the specified key
+// converted to a list
+func (ec *envConfig) GetStringSlice(key ...string) ([]string, error) {
+	return getStringSlice(ec, key...)
+}
+
+// Decode binds the subtree under prefix to a struct
+func (ec *envConfig) Decode(prefix string, v interface{}) error {
+	return decode(ec, prefix, v)
+}
+
+// Watch does nothing for envConfig, environment variables do not change
+func (ec *envConfig) Watch(key string, fn func(old, new string)) {
+}
+
 func (ec *envConfig) getEnv(key ...string) (string, error) {
 
-	fullKey := strings.ToUpper(strings.Join(key, "_"))
+	names := envNames(ec.prefix, key...)
+
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value, nil
+		}
+	}
+
+	return "", errors.New("key " + names[0] + " not found")
+}
+
+var (
+	// KumuluzEE: dots and brackets are underscores, underscores are
+	// doubled and dashes are removed (list_items[0].max-size is
+	// LIST__ITEMS_0__MAXSIZE)
+	escapedEnvName = strings.NewReplacer("_", "__", ".", "_", "[", "_", "]", "_", "-", "")
+
+	// Legacy KumuluzEE: dots are underscores, brackets and dashes are
+	// removed (datasources[0].connection-url is DATASOURCES0_CONNECTIONURL)
+	legacyEnvName = strings.NewReplacer(".", "_", "[", "", "]", "", "-", "")
+)
+
+// envNames returns the names of the environment variables of key,
+// in the order they are looked up
+func envNames(prefix string, key ...string) []string {
+
+	fullKey := strings.ToUpper(strings.Join(key, "."))
 
-	value := os.Getenv(fullKey)
+	escaped := prefix + escapedEnvName.Replace(fullKey)
+	legacy := prefix + legacyEnvName.Replace(fullKey)
 
-	if value == "" {
-		return "", errors.New("key " + fullKey + " not found")
+	if escaped == legacy {
+		return []string{escaped}
 	}
 
-	return value, nil
+	return []string{escaped, legacy}
 }
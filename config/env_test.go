@@ -0,0 +1,75 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestEnvNames(t *testing.T) {
+
+	tests := []struct {
+		prefix string
+		key    []string
+		want   []string
+	}{
+		{"", []string{"maps", "api", "key"}, []string{"MAPS_API_KEY"}},
+		{"BIKESHARE_DIRECTIONS_", []string{"maps", "api", "key"}, []string{"BIKESHARE_DIRECTIONS_MAPS_API_KEY"}},
+		{"", []string{"upstream.maps.breaker.threshold"}, []string{"UPSTREAM_MAPS_BREAKER_THRESHOLD"}},
+		{"", []string{"kumuluzee", "config", "etcd", "start-retry-delay-ms"}, []string{"KUMULUZEE_CONFIG_ETCD_STARTRETRYDELAYMS"}},
+		{"", []string{"list_items[0]", "max-size"}, []string{"LIST__ITEMS_0__MAXSIZE", "LIST_ITEMS0_MAXSIZE"}},
+		{"", []string{"datasources[0]", "connection-url"}, []string{"DATASOURCES_0__CONNECTIONURL", "DATASOURCES0_CONNECTIONURL"}},
+		{"APP_", []string{"cache_ttl"}, []string{"APP_CACHE__TTL", "APP_CACHE_TTL"}},
+	}
+
+	for _, test := range tests {
+		if names := envNames(test.prefix, test.key...); !reflect.DeepEqual(names, test.want) {
+			t.Errorf("envNames(%q, %q) = %q, want %q", test.prefix, test.key, names, test.want)
+		}
+	}
+}
+
+func TestEnvConfigGet(t *testing.T) {
+
+	defer setenv(t, "TEST_LIST__ITEMS_0__MAXSIZE", "10")()
+	defer setenv(t, "TEST_DATASOURCES0_CONNECTIONURL", "jdbc:postgresql://localhost/db")()
+
+	ec := NewEnvConfig("test")
+
+	tests := []struct {
+		key  []string
+		want string
+	}{
+		// Escaped names
+		{[]string{"list_items[0]", "max-size"}, "10"},
+		// Legacy names
+		{[]string{"datasources[0]", "connection-url"}, "jdbc:postgresql://localhost/db"},
+	}
+
+	for _, test := range tests {
+		if value, err := ec.Get(test.key...); err != nil || value != test.want {
+			t.Errorf("Get(%q) = %q, %v, want %q", test.key, value, err, test.want)
+		}
+	}
+
+	if _, err := ec.Get("missing"); err == nil {
+		t.Error("Get(missing) succeeded")
+	}
+}
+
+// setenv sets an environment variable and returns a function restoring it
+func setenv(t *testing.T, name, value string) func() {
+
+	old, set := os.LookupEnv(name)
+	if err := os.Setenv(name, value); err != nil {
+		t.Fatal(err)
+	}
+
+	return func() {
+		if set {
+			os.Setenv(name, old)
+		} else {
+			os.Unsetenv(name)
+		}
+	}
+}
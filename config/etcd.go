@@ -4,24 +4,44 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	log "github.com/sirupsen/logrus"
 	etcd3 "go.etcd.io/etcd/clientv3"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/metrics"
+	"github.com/nimbo-stratuz/bikeshare-directions/tracing"
 )
 
-// etcdConfig is a client for communication with etcd
+// etcdConfig is a client for communication with etcd (v3 API).
+// All keys under the prefixes of the layout are kept in memory by
+// a prefix watch each.
 type etcdConfig struct {
-	cli    *etcd3.Client
-	prefix string
+	cli      *etcd3.Client
+	layout   KeyLayout
+	prefixes []string
+
+	mutex    *sync.RWMutex
+	synced   bool // false until the snapshot is loaded, and after watch errors
+	snapshot map[string]etcdValue
+	watchers map[string][]func(old, new string) // Keyed by config key
+
+	cancel context.CancelFunc
 }
 
-// NewEtcdConfig creates an etcdConfig instance
-func NewEtcdConfig(prefix string, conf etcd3.Config) (WritableConfig, error) {
+// etcdValue is a value in the snapshot with the revision it was
+// modified at, so that older watch events do not overwrite newer puts
+type etcdValue struct {
+	value    string
+	revision int64
+}
 
-	prefix = strings.TrimRight(prefix, "/") + "/"
+// NewEtcdConfig creates an etcdConfig instance, which stores keys
+// in layout
+func NewEtcdConfig(layout KeyLayout, conf etcd3.Config) (WritableConfig, error) {
 
 	var err error
 	etcdClient, err := etcd3.New(conf)
@@ -29,15 +49,44 @@ func NewEtcdConfig(prefix string, conf etcd3.Config) (WritableConfig, error) {
 		return nil, err
 	}
 
-	return &etcdConfig{
-		cli:    etcdClient,
-		prefix: prefix,
-	}, nil
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ec := &etcdConfig{
+		cli:      etcdClient,
+		layout:   layout,
+		prefixes: layout.Prefixes(),
+
+		mutex:    &sync.RWMutex{},
+		snapshot: make(map[string]etcdValue),
+		watchers: make(map[string][]func(old, new string)),
+
+		cancel: cancel,
+	}
+
+	go ec.runWatch(ctx)
+
+	return ec, nil
 }
 
-// Close closes the etcd client
+// Name of the source
+func (ec *etcdConfig) Name() string {
+	return "etcd"
+}
+
+// Ping checks that etcd is reachable
+func (ec *etcdConfig) Ping(ctx context.Context) error {
+
+	start := time.Now()
+	_, err := ec.cli.Get(ctx, ec.layout.Keys("env")[0])
+	metrics.ObserveUpstream("etcd", start, err)
+
+	return err
+}
+
+// Close stops the watch and closes the etcd client
 func (ec *etcdConfig) Close() error {
-	log.Println("Closing etcdConfig")
+	log.Info("Closing etcdConfig")
+	ec.cancel()
 	return ec.cli.Close()
 }
 
@@ -45,7 +94,7 @@ func (ec *etcdConfig) Close() error {
 // Not accessible (etcdConfig is not exported)
 func (ec *etcdConfig) Put(k string, v interface{}) (interface{}, error) {
 
-	err := ec.setEtcd(k, v)
+	err := ec.setEtcd(ec.layout.Keys(k)[0], v)
 	if err != nil {
 		return nil, err
 	}
@@ -53,6 +102,77 @@ func (ec *etcdConfig) Put(k string, v interface{}) (interface{}, error) {
 	return v, nil
 }
 
+// Count returns the value of the counter key, read from etcd
+func (ec *etcdConfig) Count(key string) (int, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+
+	_, value, err := ec.readCounter(ctx, ec.layout.SharedKey(key))
+
+	return value, err
+}
+
+// Add atomically adds delta to the counter key in a transaction that
+// compares the mod revision, retrying while other instances write it
+func (ec *etcdConfig) Add(key string, delta int) (int, error) {
+
+	fullKey := ec.layout.SharedKey(key)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	for {
+		revision, value, err := ec.readCounter(ctx, fullKey)
+		if err != nil {
+			return 0, err
+		}
+
+		// A missing key has a create revision of 0
+		cmp := etcd3.Compare(etcd3.ModRevision(fullKey), "=", revision)
+		if revision == 0 {
+			cmp = etcd3.Compare(etcd3.CreateRevision(fullKey), "=", 0)
+		}
+
+		start := time.Now()
+		resp, err := ec.cli.Txn(ctx).
+			If(cmp).
+			Then(etcd3.OpPut(fullKey, strconv.Itoa(value+delta))).
+			Commit()
+		metrics.ObserveUpstream("etcd", start, err)
+		if err != nil {
+			return 0, err
+		}
+
+		if resp.Succeeded {
+			return value + delta, nil
+		}
+	}
+}
+
+// readCounter returns the value of a counter with its mod revision,
+// which is 0 if the counter does not exist
+func (ec *etcdConfig) readCounter(ctx context.Context, fullKey string) (int64, int, error) {
+
+	start := time.Now()
+	resp, err := ec.cli.Get(ctx, fullKey)
+	metrics.ObserveUpstream("etcd", start, err)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		return 0, 0, nil
+	}
+
+	value, err := strconv.Atoi(string(resp.Kvs[0].Value))
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid counter %s: %s", fullKey, err)
+	}
+
+	return resp.Kvs[0].ModRevision, value, nil
+}
+
 // Get returns a string for the specified key
 func (ec *etcdConfig) Get(k ...string) (string, error) {
 
@@ -80,37 +200,327 @@ func (ec *etcdConfig) GetInt(k ...string) (int, error) {
 	return int(intValue), nil
 }
 
+// GetBool returns a string for the specified key converted to a bool
+func (ec *etcdConfig) GetBool(key ...string) (bool, error) {
+	return getBool(ec, key...)
+}
+
+// GetFloat returns a string for the specified key converted to a float
+func (ec *etcdConfig) GetFloat(key ...string) (float64, error) {
+	return getFloat(ec, key...)
+}
+
+// GetDuration returns a string for the specified key converted to a duration
+func (ec *etcdConfig) GetDuration(key ...string) (time.Duration, error) {
+	return getDuration(ec, key...)
+}
+
+// GetStringSlice returns a comma-separated string for the specified key
+// converted to a list
+func (ec *etcdConfig) GetStringSlice(key ...string) ([]string, error) {
+	return getStringSlice(ec, key...)
+}
+
+// Decode binds the subtree under prefix to a struct
+func (ec *etcdConfig) Decode(prefix string, v interface{}) error {
+	return decode(ec, prefix, v)
+}
+
+// Watch calls fn when the value of key (e.g. "maps.api.key") changes
+// in etcd. The value is looked up in the keys of the layout, so a change
+// of a key that is overridden by an earlier one is ignored. A deleted key
+// has an empty value. fn is called from a separate goroutine.
+func (ec *etcdConfig) Watch(key string, fn func(old, new string)) {
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+
+	ec.watchers[key] = append(ec.watchers[key], fn)
+}
+
+// lookup returns the value of the first key of the layout that is
+// in snapshot. Must be called with mutex locked.
+func (ec *etcdConfig) lookup(snapshot map[string]etcdValue, key ...string) (string, bool) {
+
+	for _, k := range ec.layout.Keys(key...) {
+		if v, ok := snapshot[k]; ok {
+			return v.value, true
+		}
+	}
+
+	return "", false
+}
+
 func (ec *etcdConfig) setEtcd(key string, value interface{}) error {
 
-	key = ec.prefix + strings.TrimLeft(key, "/")
+	stringValue := fmt.Sprint(value)
 
+	start := time.Now()
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
-	_, err := ec.cli.Put(ctx, key, fmt.Sprint(value))
+	resp, err := ec.cli.Put(ctx, key, stringValue)
 	cancel()
+	metrics.ObserveUpstream("etcd", start, err)
 	if err != nil {
 		return err
 	}
 
+	// Read your own writes before the watch event arrives
+	ec.apply(key, true, stringValue, resp.Header.Revision)
+
 	return nil
 }
 
+// getEtcd returns the value of key from the snapshot, or from etcd
+// while the snapshot is not in sync
 func (ec *etcdConfig) getEtcd(key ...string) (string, error) {
 
-	fullKey := strings.ToLower(strings.Join(key, "/"))
-	fullKey = ec.prefix + strings.TrimLeft(fullKey, "/")
+	keys := ec.layout.Keys(key...)
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	ec.mutex.RLock()
+	synced := ec.synced
+	value, ok := ec.lookup(ec.snapshot, key...)
+	ec.mutex.RUnlock()
+
+	if synced {
+		if !ok {
+			return "", errors.New("key " + keys[0] + " not found")
+		}
+		return value, nil
+	}
+
+	for _, fullKey := range keys {
+		value, ok, err := ec.read(fullKey)
+		if err != nil {
+			return "", err
+		} else if ok {
+			return value, nil
+		}
+	}
+
+	return "", errors.New("key " + keys[0] + " not found")
+}
+
+// read gets the value of key from etcd
+func (ec *etcdConfig) read(fullKey string) (string, bool, error) {
+
+	ctx, span := tracing.StartSpan(context.Background(), "config.etcd.Get", tracing.KindClient)
+	defer span.End()
+
+	span.SetAttribute("config.key", fullKey)
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*2)
 	resp, err := ec.cli.Get(ctx, fullKey)
 	cancel()
+	metrics.ObserveUpstream("etcd", start, err)
 	if err != nil {
-		return "", err
+		span.SetError(err)
+		return "", false, err
 	}
 
 	for _, ev := range resp.Kvs {
 		if string(ev.Key) == fullKey {
-			return string(ev.Value), nil
+			return string(ev.Value), true, nil
+		}
+	}
+
+	return "", false, nil
+}
+
+// runWatch loads all keys under the prefixes and keeps them up to date
+// until ctx is canceled. After an error (e.g. a lost connection or
+// a compacted revision), the snapshot is loaded again and watching resumes.
+func (ec *etcdConfig) runWatch(ctx context.Context) {
+
+	logger := log.WithField("prefixes", strings.Join(ec.prefixes, ","))
+	logger.Debug("Watching config prefixes")
+
+	for {
+		err := ec.watchPrefixes(ctx)
+		if ctx.Err() != nil {
+			break
+		}
+
+		logger.Warn("etcd Watch: ", err)
+
+		ec.mutex.Lock()
+		ec.synced = false
+		ec.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(2 * time.Second):
+			continue
+		}
+		break
+	}
+
+	logger.Debug("Canceled watch")
+}
+
+// watchPrefixes loads the snapshot and applies the events of the
+// watches of all prefixes until one of them fails
+func (ec *etcdConfig) watchPrefixes(ctx context.Context) error {
+
+	revision, err := ec.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Fail the watches if the member loses its leader, instead of waiting
+	watchCtx, cancel := context.WithCancel(etcd3.WithRequireLeader(ctx))
+	defer cancel()
+
+	responses := make(chan etcd3.WatchResponse)
+	closed := make(chan struct{}, len(ec.prefixes))
+
+	for _, prefix := range ec.prefixes {
+		watchChan := ec.cli.Watch(watchCtx, prefix, etcd3.WithPrefix(), etcd3.WithRev(revision+1))
+
+		go func() {
+			for resp := range watchChan {
+				select {
+				case responses <- resp:
+				case <-watchCtx.Done():
+					return
+				}
+			}
+			closed <- struct{}{}
+		}()
+	}
+
+	for {
+		select {
+		case resp := <-responses:
+			if err := resp.Err(); err != nil {
+				return err
+			}
+
+			for _, ev := range resp.Events {
+				if ev.Type == etcd3.EventTypeDelete {
+					ec.apply(string(ev.Kv.Key), false, "", ev.Kv.ModRevision)
+				} else {
+					ec.apply(string(ev.Kv.Key), true, string(ev.Kv.Value), ev.Kv.ModRevision)
+				}
+			}
+
+		case <-closed:
+			return errors.New("watch closed")
+		}
+	}
+}
+
+// load replaces the snapshot with all keys under the prefixes, read at
+// the same revision, and returns the revision to watch from. Subscribers
+// are notified of keys that changed while the snapshot was out of sync.
+func (ec *etcdConfig) load(ctx context.Context) (int64, error) {
+
+	ctx, span := tracing.StartSpan(ctx, "config.etcd.Load", tracing.KindClient)
+	defer span.End()
+
+	span.SetAttribute("config.prefix", strings.Join(ec.prefixes, ","))
+
+	var revision int64
+	snapshot := make(map[string]etcdValue)
+
+	for _, prefix := range ec.prefixes {
+
+		opts := []etcd3.OpOption{etcd3.WithPrefix()}
+		if revision != 0 {
+			opts = append(opts, etcd3.WithRev(revision))
+		}
+
+		start := time.Now()
+		getCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+		resp, err := ec.cli.Get(getCtx, prefix, opts...)
+		cancel()
+		metrics.ObserveUpstream("etcd", start, err)
+		if err != nil {
+			span.SetError(err)
+			return 0, err
+		}
+
+		revision = resp.Header.Revision
+		for _, kv := range resp.Kvs {
+			snapshot[string(kv.Key)] = etcdValue{string(kv.Value), kv.ModRevision}
 		}
 	}
 
-	return "", errors.New("key " + fullKey + " not found")
+	ec.mutex.Lock()
+	notify := ec.changes(snapshot)
+	ec.snapshot = snapshot
+	ec.synced = true
+	ec.mutex.Unlock()
+
+	notify()
+
+	return revision, nil
+}
+
+// apply updates key in the snapshot, unless it has a newer revision,
+// and notifies subscribers if the value changed
+func (ec *etcdConfig) apply(key string, exists bool, value string, revision int64) {
+
+	ec.mutex.Lock()
+	old, ok := ec.snapshot[key]
+	if ok && old.revision > revision {
+		ec.mutex.Unlock()
+		return
+	}
+
+	if old.value == value && ok == exists {
+		if exists {
+			ec.snapshot[key] = etcdValue{value, revision}
+		}
+		ec.mutex.Unlock()
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"key":    key,
+		"value":  RedactValue(key, value),
+		"exists": exists,
+	}).Info("Config changed")
+
+	snapshot := make(map[string]etcdValue, len(ec.snapshot))
+	for k, v := range ec.snapshot {
+		snapshot[k] = v
+	}
+	if exists {
+		snapshot[key] = etcdValue{value, revision}
+	} else {
+		delete(snapshot, key)
+	}
+
+	notify := ec.changes(snapshot)
+	ec.snapshot = snapshot
+	ec.mutex.Unlock()
+
+	notify()
+}
+
+// changes returns a function that calls the subscribers of keys whose
+// value differs in snapshot. Must be called with mutex locked.
+func (ec *etcdConfig) changes(snapshot map[string]etcdValue) func() {
+
+	var calls []func()
+
+	for key, fns := range ec.watchers {
+		path := strings.Split(key, ".")
+		old, _ := ec.lookup(ec.snapshot, path...)
+		new, _ := ec.lookup(snapshot, path...)
+		if old == new {
+			continue
+		}
+
+		for _, fn := range fns {
+			fn := fn
+			calls = append(calls, func() { fn(old, new) })
+		}
+	}
+
+	return func() {
+		for _, call := range calls {
+			call()
+		}
+	}
 }
@@ -3,28 +3,41 @@ package config
 import (
 	"context"
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	log "github.com/sirupsen/logrus"
 	etcd2 "go.etcd.io/etcd/client"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/metrics"
+	"github.com/nimbo-stratuz/bikeshare-directions/tracing"
 )
 
 type etcd2Config struct {
-	kapi etcd2.KeysAPI
+	kapi   etcd2.KeysAPI
+	layout KeyLayout
 
 	watchedMutex *sync.Mutex
-	watched      map[string]watch
+	watched      map[string]*watch
 }
 
+// watch caches the value of a key, which is kept up to date by an etcd
+// watcher, and notifies subscribers of changes
 type watch struct {
-	value string
+	synced bool // false until the value is read, and after watch errors
+	read   bool // the value has been read at least once
+	exists bool
+	value  string
+
+	funcs []func(old, new string)
 	quit  chan bool
 }
 
-func NewEtcd2Config(conf etcd2.Config) (WritableConfig, error) {
+// NewEtcd2Config creates an etcd2Config instance, which stores keys
+// in layout
+func NewEtcd2Config(conf etcd2.Config, layout KeyLayout) (WritableConfig, error) {
 
 	var err error
 	etcdClient, err := etcd2.New(conf)
@@ -35,41 +48,40 @@ func NewEtcd2Config(conf etcd2.Config) (WritableConfig, error) {
 	keysAPI := etcd2.NewKeysAPI(etcdClient)
 
 	return &etcd2Config{
-		kapi: keysAPI,
+		kapi:   keysAPI,
+		layout: layout,
 
 		watchedMutex: &sync.Mutex{},
-		watched:      make(map[string]watch),
+		watched:      make(map[string]*watch),
 	}, nil
 }
 
-func (ec *etcd2Config) getWatched(key string) (string, bool) {
-	ec.watchedMutex.Lock()
-	defer ec.watchedMutex.Unlock()
-
-	if val, ok := ec.watched[key]; ok {
-		return val.value, true
-	}
-
-	return "", false
+// Name of the source
+func (ec *etcd2Config) Name() string {
+	return "etcd"
 }
 
-func (ec *etcd2Config) setWatched(key string, value string) {
-	ec.watchedMutex.Lock()
-	defer ec.watchedMutex.Unlock()
+// Ping checks that etcd is reachable. A missing key is a valid response.
+func (ec *etcd2Config) Ping(ctx context.Context) error {
 
-	wtch := ec.watched[key]
-	wtch = watch{
-		value: value,
-		quit:  wtch.quit,
+	start := time.Now()
+	_, err := ec.kapi.Get(ctx, ec.layout.Keys("env")[0], nil)
+	observeEtcd2(start, err)
+	if err != nil && !etcd2.IsKeyNotFound(err) {
+		return err
 	}
-	ec.watched[key] = wtch
+
+	return nil
 }
 
 // Close closes the etcd client and stops all watches
 func (ec *etcd2Config) Close() error {
+	ec.watchedMutex.Lock()
+	defer ec.watchedMutex.Unlock()
 
-	for _, wtch := range ec.watched {
-		wtch.quit <- true
+	for key, wtch := range ec.watched {
+		close(wtch.quit)
+		delete(ec.watched, key)
 	}
 
 	return nil
@@ -79,7 +91,7 @@ func (ec *etcd2Config) Close() error {
 // Not accessible (etcdConfig is not exported)
 func (ec *etcd2Config) Put(k string, v interface{}) (interface{}, error) {
 
-	err := ec.setEtcd(k, v)
+	err := ec.setEtcd(ec.layout.Keys(k)[0], v)
 	if err != nil {
 		return nil, err
 	}
@@ -87,10 +99,78 @@ func (ec *etcd2Config) Put(k string, v interface{}) (interface{}, error) {
 	return v, nil
 }
 
+// Count returns the value of the counter key, read from etcd
+func (ec *etcd2Config) Count(key string) (int, error) {
+
+	_, value, err := ec.readCounter(context.Background(), ec.layout.SharedKey(key))
+
+	return value, err
+}
+
+// Add atomically adds delta to the counter key with compare-and-swap
+// on the modified index, retrying while other instances write it
+func (ec *etcd2Config) Add(key string, delta int) (int, error) {
+
+	fullKey := ec.layout.SharedKey(key)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	for {
+		index, value, err := ec.readCounter(ctx, fullKey)
+		if err != nil {
+			return 0, err
+		}
+
+		newValue := strconv.Itoa(value + delta)
+
+		start := time.Now()
+		if index == 0 {
+			_, err = ec.kapi.Set(ctx, fullKey, newValue, &etcd2.SetOptions{PrevExist: etcd2.PrevNoExist})
+		} else {
+			_, err = ec.kapi.Set(ctx, fullKey, newValue, &etcd2.SetOptions{PrevIndex: index})
+		}
+		observeEtcd2(start, err)
+
+		if etcdErr, ok := err.(etcd2.Error); ok &&
+			(etcdErr.Code == etcd2.ErrorCodeTestFailed || etcdErr.Code == etcd2.ErrorCodeNodeExist) {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+
+		return value + delta, nil
+	}
+}
+
+// readCounter returns the value of a counter with its modified index,
+// which is 0 if the counter does not exist
+func (ec *etcd2Config) readCounter(ctx context.Context, fullKey string) (uint64, int, error) {
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*2)
+	resp, err := ec.kapi.Get(ctx, fullKey, &etcd2.GetOptions{Quorum: true})
+	cancel()
+	observeEtcd2(start, err)
+
+	if etcd2.IsKeyNotFound(err) {
+		return 0, 0, nil
+	} else if err != nil {
+		return 0, 0, err
+	}
+
+	value, err := strconv.Atoi(resp.Node.Value)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid counter %s: %s", fullKey, err)
+	}
+
+	return resp.Node.ModifiedIndex, value, nil
+}
+
 // Get returns a string for the specified key
 func (ec *etcd2Config) Get(k ...string) (string, error) {
 
-	stringValue, err := ec.getEtcd(genKey(k...))
+	stringValue, err := ec.lookup(k...)
 	if err != nil {
 		return "", err
 	}
@@ -101,7 +181,7 @@ func (ec *etcd2Config) Get(k ...string) (string, error) {
 // GetInt returns a string for the specified key converted to a 32 bit integer
 func (ec *etcd2Config) GetInt(k ...string) (int, error) {
 
-	stringValue, err := ec.getEtcd(genKey(k...))
+	stringValue, err := ec.lookup(k...)
 	if err != nil {
 		return 0, err
 	}
@@ -114,82 +194,272 @@ func (ec *etcd2Config) GetInt(k ...string) (int, error) {
 	return int(intValue), nil
 }
 
+// GetBool returns a string for the specified key converted to a bool
+func (ec *etcd2Config) GetBool(key ...string) (bool, error) {
+	return getBool(ec, key...)
+}
+
+// GetFloat returns a string for the specified key converted to a float
+func (ec *etcd2Config) GetFloat(key ...string) (float64, error) {
+	return getFloat(ec, key...)
+}
+
+// GetDuration returns a string for the specified key converted to a duration
+func (ec *etcd2Config) GetDuration(key ...string) (time.Duration, error) {
+	return getDuration(ec, key...)
+}
+
+// GetStringSlice returns a comma-separated string for the specified key
+// converted to a list
+func (ec *etcd2Config) GetStringSlice(key ...string) ([]string, error) {
+	return getStringSlice(ec, key...)
+}
+
+// Decode binds the subtree under prefix to a struct
+func (ec *etcd2Config) Decode(prefix string, v interface{}) error {
+	return decode(ec, prefix, v)
+}
+
+// Watch calls fn when the value of key (e.g. "maps.api.key") changes
+// in etcd. The value is looked up in the keys of the layout, so a change
+// of a key that is overridden by an earlier one is ignored. A deleted key
+// has an empty value. fn is called from a separate goroutine.
+func (ec *etcd2Config) Watch(key string, fn func(old, new string)) {
+
+	keys := ec.layout.Keys(strings.Split(key, ".")...)
+
+	// Start the watches and get the current value
+	last, _ := ec.lookup(strings.Split(key, ".")...)
+	lastMutex := &sync.Mutex{}
+
+	onChange := func(_, _ string) {
+		lastMutex.Lock()
+		defer lastMutex.Unlock()
+
+		ec.watchedMutex.Lock()
+		value := ""
+		for _, k := range keys {
+			if wtch := ec.watched[k]; wtch != nil && wtch.exists {
+				value = wtch.value
+				break
+			}
+		}
+		ec.watchedMutex.Unlock()
+
+		if value != last {
+			fn(last, value)
+			last = value
+		}
+	}
+
+	ec.watchedMutex.Lock()
+	defer ec.watchedMutex.Unlock()
+
+	for _, k := range keys {
+		wtch := ec.startWatch(k)
+		wtch.funcs = append(wtch.funcs, onChange)
+	}
+}
+
+// lookup returns the value of the first key of the layout that exists
+func (ec *etcd2Config) lookup(key ...string) (string, error) {
+
+	keys := ec.layout.Keys(key...)
+
+	for _, k := range keys {
+		exists, value, err := ec.getEtcd(k)
+		if err != nil {
+			return "", err
+		} else if exists {
+			return value, nil
+		}
+	}
+
+	return "", fmt.Errorf("key %s not found", keys[0])
+}
+
 func (ec *etcd2Config) setEtcd(key string, value interface{}) error {
 
+	start := time.Now()
 	_, err := ec.kapi.Set(context.Background(), key, fmt.Sprint(value), nil)
+	observeEtcd2(start, err)
 	if err != nil {
 		return err
 	}
 
-	// Call getEtcd to start a watch
-	_, err = ec.getEtcd(key)
-	if err != nil {
-		return err
-	}
+	// Read your own writes before the watch event arrives.
+	// The watch keeps the cached value up to date.
+	ec.watchedMutex.Lock()
+	wtch := ec.startWatch(key)
+	ec.watchedMutex.Unlock()
+
+	ec.update(key, wtch, true, fmt.Sprint(value))
+
 	return nil
 }
 
-func (ec *etcd2Config) getEtcd(key string) (string, error) {
+// getEtcd returns the value of key, if it exists. Keys (including missing
+// ones) are watched after the first read, and later read from the cache.
+func (ec *etcd2Config) getEtcd(key string) (bool, string, error) {
+
+	ec.watchedMutex.Lock()
+	wtch := ec.startWatch(key)
+	synced, exists, value := wtch.synced, wtch.exists, wtch.value
+	ec.watchedMutex.Unlock()
 
-	// Check if the key is already watched
-	if val, ok := ec.getWatched(key); ok {
-		return val, nil
+	if !synced {
+		var err error
+		if exists, value, _, err = ec.read(context.Background(), key); err != nil {
+			return false, "", err
+		}
 	}
 
-	// Get initial value
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	return exists, value, nil
+}
+
+// read gets the value of key from etcd, with the etcd index to watch from
+func (ec *etcd2Config) read(ctx context.Context, key string) (exists bool, value string, index uint64, err error) {
+
+	ctx, span := tracing.StartSpan(ctx, "config.etcd.Get", tracing.KindClient)
+	defer span.End()
+
+	span.SetAttribute("config.key", key)
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, time.Second*2)
 	resp, err := ec.kapi.Get(ctx, key, nil)
 	cancel()
-	if err != nil {
-		return "", err
+	observeEtcd2(start, err)
+
+	if etcd2.IsKeyNotFound(err) {
+		if etcdErr, ok := err.(etcd2.Error); ok {
+			index = etcdErr.Index
+		}
+		return false, "", index, nil
+	} else if err != nil {
+		span.SetError(err)
+		return false, "", 0, err
 	}
 
-	initialValue := resp.Node.Value
+	return true, resp.Node.Value, resp.Index, nil
+}
 
-	ec.watchedMutex.Lock()
-	wtch := watch{
-		value: initialValue,
-		quit:  make(chan bool),
+// startWatch returns the watch of key, starting it if needed.
+// The caller must hold watchedMutex.
+func (ec *etcd2Config) startWatch(key string) *watch {
+
+	if wtch, ok := ec.watched[key]; ok {
+		return wtch
 	}
+
+	wtch := &watch{quit: make(chan bool)}
 	ec.watched[key] = wtch
-	ec.watchedMutex.Unlock()
 
-	// Wait for changes and update ec.watched
+	go ec.runWatch(key, wtch)
+
+	return wtch
+}
+
+// runWatch keeps the watch of key up to date until it is closed.
+// After an error, the value is read again and watching resumes.
+func (ec *etcd2Config) runWatch(key string, wtch *watch) {
+
+	log.WithField("key", key).Debug("Watching config key")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	go func() {
-		log.Println("Watching key " + key)
-		watcher := ec.kapi.Watcher(key, nil)
-		for {
-			// Create a context that will also timeout on <-quit
-			ctx := context.TODO()
-			ctx, cancel := context.WithCancel(ctx)
-			defer cancel()
-			go func() {
-				select {
-				case <-ctx.Done():
-				case <-wtch.quit:
-					cancel()
-				}
-			}()
-
-			// Wait for a change with the defined context
-			resp, err := watcher.Next(ctx)
-			if err != nil {
-				if err == context.Canceled {
-					log.Printf("Canceled watch for key %s\n", key)
-					return
-				} else {
-					log.Printf("etcd2 Watch: %s\n", err.Error())
+		<-wtch.quit
+		cancel()
+	}()
+
+	retry := func(err error) bool {
+		log.WithField("key", key).Warn("etcd2 Watch: ", err)
+
+		ec.watchedMutex.Lock()
+		wtch.synced = false
+		ec.watchedMutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(2 * time.Second):
+			return true
+		}
+	}
+
+	var watcher etcd2.Watcher
+
+	for {
+		if watcher == nil {
+			exists, value, index, err := ec.read(ctx, key)
+			if ctx.Err() != nil {
+				break
+			} else if err != nil {
+				if retry(err) {
+					continue
 				}
+				break
 			}
 
-			log.Printf("[Change: %s] Key: '%s' | Value: %s",
-				resp.Action, resp.Node.Key, resp.Node.Value)
+			ec.update(key, wtch, exists, value)
+			watcher = ec.kapi.Watcher(key, &etcd2.WatcherOptions{AfterIndex: index})
+		}
 
-			ec.setWatched(key, resp.Node.Value)
+		// Wait for a change
+		resp, err := watcher.Next(ctx)
+		if ctx.Err() != nil {
+			break
+		} else if err != nil {
+			watcher = nil
+			if retry(err) {
+				continue
+			}
+			break
 		}
-	}()
 
-	return initialValue, nil
+		switch resp.Action {
+		case "delete", "expire", "compareAndDelete":
+			ec.update(key, wtch, false, "")
+		default:
+			ec.update(key, wtch, true, resp.Node.Value)
+		}
+	}
+
+	log.WithField("key", key).Debug("Canceled watch")
+}
+
+// update caches the value of key and notifies subscribers if it changed
+func (ec *etcd2Config) update(key string, wtch *watch, exists bool, value string) {
+
+	ec.watchedMutex.Lock()
+	old, changed := wtch.value, wtch.read && (wtch.exists != exists || wtch.value != value)
+	wtch.synced, wtch.read, wtch.exists, wtch.value = true, true, exists, value
+	funcs := append([]func(old, new string){}, wtch.funcs...)
+	ec.watchedMutex.Unlock()
+
+	if !changed {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"key":    key,
+		"value":  RedactValue(key, value),
+		"exists": exists,
+	}).Info("Config changed")
+
+	for _, fn := range funcs {
+		fn(old, value)
+	}
+}
+
+// observeEtcd2 records an etcd call. Missing keys are a valid response.
+func observeEtcd2(start time.Time, err error) {
+	if etcd2.IsKeyNotFound(err) {
+		err = nil
+	}
+	metrics.ObserveUpstream("etcd", start, err)
 }
 
 func genKey(key ...string) string {
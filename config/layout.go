@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeyLayout maps config keys (e.g. "maps", "api", "key") to etcd keys
+type KeyLayout interface {
+	// Prefixes are the namespaces of config keys, which contain all keys
+	// returned by Keys
+	Prefixes() []string
+	// Keys returns the etcd keys of key, in the order they are looked up.
+	// The first one is written to.
+	Keys(key ...string) []string
+	// SharedKey returns the etcd key of state shared by all versions of
+	// the service (e.g. counters), in a "state/" namespace next to config
+	SharedKey(key ...string) string
+}
+
+// stateNamespace holds SharedKeys, apart from config keys
+const stateNamespace = "state/"
+
+// prefixLayout stores keys under a prefix, e.g. maps/api/key, and
+// shared keys under state/ of the prefix, or of its parent if the prefix
+// is versioned
+type prefixLayout struct {
+	prefix string
+	shared string
+}
+
+// NewPrefixLayout creates a KeyLayout that stores keys under prefix
+// ("" for the root)
+func NewPrefixLayout(prefix string) KeyLayout {
+
+	prefix = trimPrefix(prefix)
+
+	return &prefixLayout{prefix: prefix, shared: prefix}
+}
+
+// NewVersionedPrefixLayout creates a KeyLayout that stores keys under
+// {prefix}/{version}, and keys shared by all versions under {prefix}/state
+func NewVersionedPrefixLayout(prefix, version string) KeyLayout {
+
+	prefix = trimPrefix(prefix)
+
+	return &prefixLayout{prefix: prefix + version + "/", shared: prefix}
+}
+
+func (pl *prefixLayout) Prefixes() []string {
+	return []string{pl.prefix}
+}
+
+func (pl *prefixLayout) Keys(key ...string) []string {
+	return []string{pl.prefix + strings.TrimLeft(genKey(key...), "/")}
+}
+
+func (pl *prefixLayout) SharedKey(key ...string) string {
+	return pl.shared + stateNamespace + strings.TrimLeft(genKey(key...), "/")
+}
+
+// trimPrefix returns prefix with a single trailing slash, or "" for the root
+func trimPrefix(prefix string) string {
+
+	if prefix == "" {
+		return ""
+	}
+
+	return strings.TrimRight(prefix, "/") + "/"
+}
+
+// kumuluzEELayout stores keys like KumuluzEE config does, in the
+// namespace of the service version, with a fallback to the namespace
+// shared by all versions of the service
+type kumuluzEELayout struct {
+	namespaces []string
+	shared     string
+}
+
+// NewKumuluzEELayout creates a KeyLayout that stores keys under
+// /environments/{env}/services/{name}/{version}/config, and falls back
+// to /environments/{env}/services/{name}/config. Shared keys are
+// stored under /environments/{env}/services/{name}/state.
+func NewKumuluzEELayout(env, name, version string) KeyLayout {
+
+	prefix := fmt.Sprintf("/environments/%s/services/%s/", env, name)
+
+	return &kumuluzEELayout{
+		namespaces: []string{
+			prefix + version + "/config/",
+			prefix + "config/",
+		},
+		shared: prefix + stateNamespace,
+	}
+}
+
+func (kl *kumuluzEELayout) Prefixes() []string {
+	return kl.namespaces
+}
+
+func (kl *kumuluzEELayout) Keys(key ...string) []string {
+
+	path := strings.TrimLeft(genKey(key...), "/")
+
+	keys := make([]string, len(kl.namespaces))
+	for i, namespace := range kl.namespaces {
+		keys[i] = namespace + path
+	}
+
+	return keys
+}
+
+func (kl *kumuluzEELayout) SharedKey(key ...string) string {
+	return kl.shared + strings.TrimLeft(genKey(key...), "/")
+}
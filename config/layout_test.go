@@ -0,0 +1,82 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLayouts(t *testing.T) {
+
+	tests := []struct {
+		layout    KeyLayout
+		prefixes  []string
+		keys      []string
+		sharedKey string
+	}{
+		{
+			NewPrefixLayout(""),
+			[]string{""},
+			[]string{"maps/api/key"},
+			"state/quota/mapquest/2019-01",
+		},
+		{
+			NewPrefixLayout("/dev/bikeshare-directions/"),
+			[]string{"/dev/bikeshare-directions/"},
+			[]string{"/dev/bikeshare-directions/maps/api/key"},
+			"/dev/bikeshare-directions/state/quota/mapquest/2019-01",
+		},
+		{
+			NewVersionedPrefixLayout("/dev/bikeshare-directions", "1.0.0"),
+			[]string{"/dev/bikeshare-directions/1.0.0/"},
+			[]string{"/dev/bikeshare-directions/1.0.0/maps/api/key"},
+			"/dev/bikeshare-directions/state/quota/mapquest/2019-01",
+		},
+		{
+			NewKumuluzEELayout("dev", "bikeshare-directions", "1.0.0"),
+			[]string{
+				"/environments/dev/services/bikeshare-directions/1.0.0/config/",
+				"/environments/dev/services/bikeshare-directions/config/",
+			},
+			[]string{
+				"/environments/dev/services/bikeshare-directions/1.0.0/config/maps/api/key",
+				"/environments/dev/services/bikeshare-directions/config/maps/api/key",
+			},
+			"/environments/dev/services/bikeshare-directions/state/quota/mapquest/2019-01",
+		},
+	}
+
+	for _, test := range tests {
+
+		if prefixes := test.layout.Prefixes(); !reflect.DeepEqual(prefixes, test.prefixes) {
+			t.Errorf("%T Prefixes() = %q, want %q", test.layout, prefixes, test.prefixes)
+		}
+
+		if keys := test.layout.Keys("maps", "api", "key"); !reflect.DeepEqual(keys, test.keys) {
+			t.Errorf("%T Keys() = %q, want %q", test.layout, keys, test.keys)
+		}
+
+		if key := test.layout.SharedKey("quota/mapquest/2019-01"); key != test.sharedKey {
+			t.Errorf("%T SharedKey() = %q, want %q", test.layout, key, test.sharedKey)
+		}
+	}
+}
+
+// Versions of the service share counters, which are not config keys
+func TestSharedKeyIgnoresVersion(t *testing.T) {
+
+	for _, layouts := range [][2]KeyLayout{
+		{NewVersionedPrefixLayout("/dev/directions", "1.0.0"), NewVersionedPrefixLayout("/dev/directions", "1.1.0")},
+		{NewKumuluzEELayout("dev", "directions", "1.0.0"), NewKumuluzEELayout("dev", "directions", "1.1.0")},
+	} {
+		if older, newer := layouts[0].SharedKey("quota", "mapquest"), layouts[1].SharedKey("quota", "mapquest"); older != newer {
+			t.Errorf("%T SharedKey() differs between versions: %q, %q", layouts[0], older, newer)
+		}
+
+		for _, prefix := range layouts[0].Prefixes() {
+			if key := layouts[0].SharedKey("quota"); strings.HasPrefix(key, prefix) {
+				t.Errorf("%T SharedKey() = %q, in config prefix %q", layouts[0], key, prefix)
+			}
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Type is the type of a config value
+type Type int
+
+const (
+	TypeString      Type = iota
+	TypeInt              // 32 bit integer
+	TypeBool             // true, false, 1, 0, ...
+	TypeFloat            // 64 bit float
+	TypeDuration         // "1.5s", "300ms" or milliseconds
+	TypeStringSlice      // YAML list or comma-separated
+	TypeURL              // Absolute URL, e.g. http://localhost:2379
+)
+
+// Field declares a config key
+type Field struct {
+	Key      string // e.g. "maps.api.key"
+	Type     Type
+	Required bool
+	Default  string // Value of the key when it is not set
+
+	// Min and Max bound numbers (durations in milliseconds), if set
+	Min, Max *float64
+
+	OneOf []string // Allowed values (of each item of a list), if not empty
+}
+
+// Bound returns a pointer to n, for Min and Max of a Field
+func Bound(n float64) *float64 {
+	return &n
+}
+
+// Schema declares the config keys of a service
+type Schema []Field
+
+// Problem is an invalid config key
+type Problem struct {
+	Key     string
+	Message string
+}
+
+// ValidationError lists all problems found by Schema.Validate
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+
+	problems := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		problems[i] = fmt.Sprintf("%s: %s", p.Key, p.Message)
+	}
+
+	return "Invalid config: " + strings.Join(problems, "; ")
+}
+
+// Validate checks the keys of the schema in c. It returns
+// a *ValidationError with all problems, or nil.
+func (s Schema) Validate(c Config) error {
+
+	var problems []Problem
+
+	for _, field := range s {
+		if message := field.validate(c); message != "" {
+			problems = append(problems, Problem{Key: field.Key, Message: message})
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
+
+// Field returns the field of key, if it is declared
+func (s Schema) Field(key string) (Field, bool) {
+
+	for _, field := range s {
+		if field.Key == key {
+			return field, true
+		}
+	}
+
+	return Field{}, false
+}
+
+// ValidateValue checks value as the value of the field
+func (f Field) ValidateValue(value string) error {
+
+	if message := f.validate(defaultConfig(value)); message != "" {
+		return &ValidationError{Problems: []Problem{{Key: f.Key, Message: message}}}
+	}
+
+	return nil
+}
+
+// validate returns a description of the problem with the field in c,
+// or an empty string
+func (f Field) validate(c Config) string {
+
+	key := strings.Split(f.Key, ".")
+
+	value, err := c.Get(key...)
+	if err != nil {
+		if !f.Required {
+			return ""
+		} else if strings.HasPrefix(err.Error(), "Key not found") {
+			return "required"
+		}
+		return err.Error()
+	}
+
+	var number float64
+	var items []string
+
+	switch f.Type {
+
+	case TypeString:
+		items = []string{value}
+
+	case TypeInt:
+		n, err := c.GetInt(key...)
+		if err != nil {
+			return "not an integer"
+		}
+		number = float64(n)
+
+	case TypeBool:
+		if _, err := c.GetBool(key...); err != nil {
+			return "not a bool"
+		}
+
+	case TypeFloat:
+		if number, err = c.GetFloat(key...); err != nil {
+			return "not a number"
+		}
+
+	case TypeDuration:
+		d, err := c.GetDuration(key...)
+		if err != nil {
+			return `not a duration (e.g. "1.5s", "300ms" or milliseconds)`
+		}
+		number = float64(d / time.Millisecond)
+
+	case TypeStringSlice:
+		if items, err = c.GetStringSlice(key...); err != nil {
+			return "not a list"
+		}
+
+	case TypeURL:
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Sprintf("not an absolute URL: %q", RedactValue(f.Key, value))
+		}
+	}
+
+	if f.Min != nil && number < *f.Min {
+		return fmt.Sprintf("must be at least %v, got %v", *f.Min, number)
+	} else if f.Max != nil && number > *f.Max {
+		return fmt.Sprintf("must be at most %v, got %v", *f.Max, number)
+	}
+
+	if len(f.OneOf) > 0 {
+		for _, item := range items {
+			if !contains(f.OneOf, item) {
+				return fmt.Sprintf("must be one of %s, got %q", strings.Join(f.OneOf, ", "), RedactValue(f.Key, item))
+			}
+		}
+	}
+
+	return ""
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Defaults returns a Config with the defaults of the schema, to be used
+// as the source of lowest priority
+func (s Schema) Defaults() Config {
+
+	defaults := make(schemaDefaults)
+	for _, field := range s {
+		if field.Default != "" {
+			defaults[field.Key] = field.Default
+		}
+	}
+
+	return defaults
+}
+
+// schemaDefaults is a Config of default values, keyed by dotted keys
+type schemaDefaults map[string]string
+
+func (sd schemaDefaults) Name() string {
+	return "default"
+}
+
+func (sd schemaDefaults) Close() error {
+	return nil
+}
+
+func (sd schemaDefaults) Get(key ...string) (string, error) {
+
+	fullKey := strings.Join(key, ".")
+
+	value, ok := sd[fullKey]
+	if !ok {
+		return "", fmt.Errorf("Key not found: %s", fullKey)
+	}
+
+	return value, nil
+}
+
+func (sd schemaDefaults) GetInt(key ...string) (int, error) {
+
+	value, err := sd.Get(key...)
+	if err != nil {
+		return 0, err
+	}
+
+	return defaultConfig(value).GetInt()
+}
+
+func (sd schemaDefaults) GetBool(key ...string) (bool, error) {
+	return getBool(sd, key...)
+}
+
+func (sd schemaDefaults) GetFloat(key ...string) (float64, error) {
+	return getFloat(sd, key...)
+}
+
+func (sd schemaDefaults) GetDuration(key ...string) (time.Duration, error) {
+	return getDuration(sd, key...)
+}
+
+func (sd schemaDefaults) GetStringSlice(key ...string) ([]string, error) {
+	return getStringSlice(sd, key...)
+}
+
+func (sd schemaDefaults) Decode(prefix string, v interface{}) error {
+	return decode(sd, prefix, v)
+}
+
+// Watch does nothing for schemaDefaults, defaults do not change
+func (sd schemaDefaults) Watch(key string, fn func(old, new string)) {
+}
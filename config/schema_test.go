@@ -0,0 +1,128 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+
+	schema := Schema{
+		{Key: "server.port", Type: TypeInt, Required: true, Min: Bound(1), Max: Bound(65535)},
+		{Key: "upstream.maps.retries", Type: TypeInt, Min: Bound(0)},
+		{Key: "upstream.maps.timeout", Type: TypeDuration, Min: Bound(1)},
+		{Key: "tracing.sampler.percent", Type: TypeInt, Min: Bound(0), Max: Bound(100)},
+		{Key: "health.cache", Type: TypeInt},
+		{Key: "routing.providers", Type: TypeStringSlice, OneOf: []string{"mapquest", "graphhopper"}},
+		{Key: "config.etcd.url", Type: TypeURL},
+		{Key: "cache.redis.url", Type: TypeURL},
+		{Key: "cache.enabled", Type: TypeBool},
+	}
+
+	tests := []struct {
+		values map[string]string
+		want   []Problem
+	}{
+		{
+			values: map[string]string{"server.port": "8080"},
+		},
+		{
+			values: map[string]string{},
+			want:   []Problem{{"server.port", "required"}},
+		},
+		{
+			values: map[string]string{"server.port": "0"},
+			want:   []Problem{{"server.port", "must be at least 1, got 0"}},
+		},
+		{
+			values: map[string]string{"server.port": "65536"},
+			want:   []Problem{{"server.port", "must be at most 65535, got 65536"}},
+		},
+		{
+			values: map[string]string{"server.port": "http"},
+			want:   []Problem{{"server.port", "not an integer"}},
+		},
+		// A Min of 0 is a bound too
+		{
+			values: map[string]string{"server.port": "80", "upstream.maps.retries": "0"},
+		},
+		{
+			values: map[string]string{"server.port": "80", "upstream.maps.retries": "-1"},
+			want:   []Problem{{"upstream.maps.retries", "must be at least 0, got -1"}},
+		},
+		{
+			values: map[string]string{"server.port": "80", "tracing.sampler.percent": "-5"},
+			want:   []Problem{{"tracing.sampler.percent", "must be at least 0, got -5"}},
+		},
+		// Fields without bounds
+		{
+			values: map[string]string{"server.port": "80", "health.cache": "-1"},
+		},
+		{
+			values: map[string]string{"server.port": "80", "upstream.maps.timeout": "1.5s"},
+		},
+		{
+			values: map[string]string{"server.port": "80", "upstream.maps.timeout": "0"},
+			want:   []Problem{{"upstream.maps.timeout", "must be at least 1, got 0"}},
+		},
+		{
+			values: map[string]string{"server.port": "80", "upstream.maps.timeout": "soon"},
+			want:   []Problem{{"upstream.maps.timeout", `not a duration (e.g. "1.5s", "300ms" or milliseconds)`}},
+		},
+		{
+			values: map[string]string{"server.port": "80", "routing.providers": "graphhopper,mapquest"},
+		},
+		{
+			values: map[string]string{"server.port": "80", "routing.providers": "mapquest,google"},
+			want:   []Problem{{"routing.providers", `must be one of mapquest, graphhopper, got "google"`}},
+		},
+		{
+			values: map[string]string{"server.port": "80", "config.etcd.url": "localhost:2379"},
+			want:   []Problem{{"config.etcd.url", `not an absolute URL: "localhost:2379"`}},
+		},
+		{
+			values: map[string]string{"server.port": "80", "cache.enabled": "maybe"},
+			want:   []Problem{{"cache.enabled", "not a bool"}},
+		},
+		// All problems are reported
+		{
+			values: map[string]string{"upstream.maps.retries": "-2", "cache.enabled": "maybe"},
+			want: []Problem{
+				{"server.port", "required"},
+				{"upstream.maps.retries", "must be at least 0, got -2"},
+				{"cache.enabled", "not a bool"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		err := schema.Validate(schemaDefaults(test.values))
+
+		if test.want == nil {
+			if err != nil {
+				t.Errorf("Validate(%v) = %v, want nil", test.values, err)
+			}
+			continue
+		}
+
+		ve, ok := err.(*ValidationError)
+		if !ok {
+			t.Errorf("Validate(%v) = %v, want a *ValidationError", test.values, err)
+			continue
+		}
+		if !reflect.DeepEqual(ve.Problems, test.want) {
+			t.Errorf("Validate(%v) problems = %v, want %v", test.values, ve.Problems, test.want)
+		}
+	}
+}
+
+func TestValidateValue(t *testing.T) {
+
+	field := Field{Key: "upstream.maps.breaker.threshold", Type: TypeInt, Min: Bound(0)}
+
+	for value, valid := range map[string]bool{"0": true, "5": true, "-1": false, "five": false} {
+		if err := field.ValidateValue(value); (err == nil) != valid {
+			t.Errorf("ValidateValue(%q) = %v, want valid %t", value, err, valid)
+		}
+	}
+}
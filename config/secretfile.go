@@ -0,0 +1,188 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/logging"
+)
+
+// secretFileConfig reads secrets mounted as files in a directory, like
+// Kubernetes secret volumes. The file of key maps.api.key is named
+// "maps.api.key". All values are secret and redacted in logs.
+type secretFileConfig struct {
+	dir string
+
+	mutex    *sync.Mutex
+	watchers map[string]*secretWatch
+
+	quit chan bool
+}
+
+type secretWatch struct {
+	value string
+	funcs []func(old, new string)
+}
+
+// NewSecretFileConfig creates a secretFileConfig instance reading files
+// in dir. Files are read on every Get, so rotated secrets are picked up.
+func NewSecretFileConfig(dir string) (Config, error) {
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("Not a directory: %s", dir)
+	}
+
+	sc := &secretFileConfig{
+		dir:      dir,
+		mutex:    &sync.Mutex{},
+		watchers: make(map[string]*secretWatch),
+		quit:     make(chan bool),
+	}
+
+	go sc.poll()
+
+	return sc, nil
+}
+
+// Name of the source
+func (sc *secretFileConfig) Name() string {
+	return "secrets"
+}
+
+// Close stops watching the files
+func (sc *secretFileConfig) Close() error {
+	close(sc.quit)
+	return nil
+}
+
+// Get returns the contents of the file of key, without the final newline
+func (sc *secretFileConfig) Get(key ...string) (string, error) {
+
+	fullKey := strings.Join(key, ".")
+
+	// Kubernetes mounts files in hidden directories (e.g. ..data),
+	// which are not keys
+	if strings.HasPrefix(fullKey, ".") || strings.ContainsAny(fullKey, `/\`) {
+		return "", fmt.Errorf("Key not found: %s", fullKey)
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(sc.dir, fullKey))
+	if err != nil {
+		return "", fmt.Errorf("Key not found: %s", fullKey)
+	}
+
+	value := strings.TrimRight(string(contents), "\r\n")
+	logging.SetSecret(sc.Name()+":"+fullKey, value)
+
+	return value, nil
+}
+
+// GetInt returns a string for the specified key converted to a 32 bit integer
+func (sc *secretFileConfig) GetInt(key ...string) (int, error) {
+
+	stringValue, err := sc.Get(key...)
+	if err != nil {
+		return 0, err
+	}
+
+	intValue, err := strconv.ParseInt(stringValue, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid int: %s", strings.Join(key, "."))
+	}
+
+	return int(intValue), nil
+}
+
+// GetBool returns a string for the specified key converted to a bool
+func (sc *secretFileConfig) GetBool(key ...string) (bool, error) {
+	return getBool(sc, key...)
+}
+
+// GetFloat returns a string for the specified key converted to a float
+func (sc *secretFileConfig) GetFloat(key ...string) (float64, error) {
+	return getFloat(sc, key...)
+}
+
+// GetDuration returns a string for the specified key converted to a duration
+func (sc *secretFileConfig) GetDuration(key ...string) (time.Duration, error) {
+	return getDuration(sc, key...)
+}
+
+// GetStringSlice returns a comma-separated string for the specified key
+// converted to a list
+func (sc *secretFileConfig) GetStringSlice(key ...string) ([]string, error) {
+	return getStringSlice(sc, key...)
+}
+
+// Decode binds the subtree under prefix to a struct
+func (sc *secretFileConfig) Decode(prefix string, v interface{}) error {
+	return decode(sc, prefix, v)
+}
+
+// Watch calls fn when the file of key changes. The files are checked
+// every ReloadInterval. A removed file has an empty value.
+func (sc *secretFileConfig) Watch(key string, fn func(old, new string)) {
+
+	value, _ := sc.Get(key)
+
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	wtch, ok := sc.watchers[key]
+	if !ok {
+		wtch = &secretWatch{value: value}
+		sc.watchers[key] = wtch
+	}
+	wtch.funcs = append(wtch.funcs, fn)
+}
+
+// poll checks the watched files every ReloadInterval, until Close is called
+func (sc *secretFileConfig) poll() {
+
+	ticker := time.NewTicker(ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sc.quit:
+			return
+		case <-ticker.C:
+			sc.check()
+		}
+	}
+}
+
+// check notifies watchers of the files that changed
+func (sc *secretFileConfig) check() {
+
+	var calls []func()
+
+	sc.mutex.Lock()
+	for key, wtch := range sc.watchers {
+		value, _ := sc.Get(key)
+		if value == wtch.value {
+			continue
+		}
+
+		old := wtch.value
+		wtch.value = value
+		for _, fn := range wtch.funcs {
+			fn := fn
+			calls = append(calls, func() { fn(old, value) })
+		}
+	}
+	sc.mutex.Unlock()
+
+	for _, call := range calls {
+		call()
+	}
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/logging"
+)
+
+// EncryptedPrefix marks encrypted values, e.g. "enc:AbC...="
+const EncryptedPrefix = "enc:"
+
+// EncryptionKeyEnv is the environment variable with the base64-encoded
+// AES key (16, 24 or 32 bytes) of encrypted values
+const EncryptionKeyEnv = "CONFIG_ENCRYPTION_KEY"
+
+// secretNames are the last parts of keys whose values are secret
+var secretNames = []string{"key", "password", "secret", "token"}
+
+// isSecretKey reports whether the value of key (e.g. "maps.api.key"
+// or "maps/api/key") is secret, based on its name
+func isSecretKey(key string) bool {
+
+	parts := strings.FieldsFunc(strings.ToLower(key), func(r rune) bool {
+		return r == '.' || r == '/'
+	})
+	if len(parts) == 0 {
+		return false
+	}
+
+	last := parts[len(parts)-1]
+	for _, name := range secretNames {
+		if strings.HasSuffix(last, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RedactValue returns the value of key as it can be logged or displayed
+func RedactValue(key, value string) string {
+
+	if value != "" && (isSecretKey(key) || strings.HasPrefix(value, EncryptedPrefix)) {
+		return logging.Redacted
+	}
+
+	return logging.Redact(redactURL(value))
+}
+
+// redactURL redacts the credentials of an absolute URL (e.g.
+// redis://:password@localhost:6379), and query parameters named like
+// secret keys (e.g. ?token=...). Other values are returned unchanged.
+func redactURL(value string) string {
+
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return value
+	}
+
+	credentials := u.User != nil
+	u.User = nil
+
+	if u.RawQuery != "" {
+		params := strings.Split(u.RawQuery, "&")
+		for i, param := range params {
+			if parts := strings.SplitN(param, "=", 2); len(parts) == 2 && isSecretKey(parts[0]) {
+				params[i] = parts[0] + "=" + logging.Redacted
+			}
+		}
+		u.RawQuery = strings.Join(params, "&")
+	}
+
+	redacted := u.String()
+	if credentials {
+		redacted = strings.Replace(redacted, "://", "://"+logging.Redacted+"@", 1)
+	}
+
+	return redacted
+}
+
+// Encrypt encrypts value with the key in CONFIG_ENCRYPTION_KEY,
+// for storing it in any config source
+func Encrypt(value string) (string, error) {
+
+	gcm, err := encryptionCipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(value), nil)
+
+	return EncryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt returns the plain text of an encrypted value. Other values
+// are returned unchanged.
+func decrypt(value string) (string, error) {
+
+	if !strings.HasPrefix(value, EncryptedPrefix) {
+		return value, nil
+	}
+
+	gcm, err := encryptionCipher()
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, EncryptedPrefix))
+	if err != nil {
+		return "", errors.New("Invalid encrypted value: " + err.Error())
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("Invalid encrypted value: too short")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+
+	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.New("Cannot decrypt value: " + err.Error())
+	}
+
+	return string(plain), nil
+}
+
+func encryptionCipher() (cipher.AEAD, error) {
+
+	encodedKey := os.Getenv(EncryptionKeyEnv)
+	if encodedKey == "" {
+		return nil, errors.New(EncryptionKeyEnv + " not set")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, errors.New(EncryptionKeyEnv + " is not base64: " + err.Error())
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,249 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Typed accessors of sources that store values as strings
+
+func getBool(c Config, key ...string) (bool, error) {
+
+	stringValue, err := c.Get(key...)
+	if err != nil {
+		return false, err
+	}
+
+	return strconv.ParseBool(stringValue)
+}
+
+func getFloat(c Config, key ...string) (float64, error) {
+
+	stringValue, err := c.Get(key...)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseFloat(stringValue, 64)
+}
+
+func getDuration(c Config, key ...string) (time.Duration, error) {
+
+	stringValue, err := c.Get(key...)
+	if err != nil {
+		return 0, err
+	}
+
+	return parseDuration(stringValue)
+}
+
+func getStringSlice(c Config, key ...string) ([]string, error) {
+
+	stringValue, err := c.Get(key...)
+	if err != nil {
+		return nil, err
+	}
+
+	return splitList(stringValue), nil
+}
+
+// parseDuration parses a duration such as "1.5s" or "300ms".
+// Bare numbers are milliseconds, like the existing *.timeout keys.
+func parseDuration(value string) (time.Duration, error) {
+
+	value = strings.TrimSpace(value)
+
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+
+	return time.ParseDuration(value)
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(value string) []string {
+
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// decode binds the subtree of c under prefix (e.g. "upstream.maps")
+// to the struct pointed to by v. Fields are bound to the key in their
+// `config` tag (which may be nested, e.g. "breaker.timeout"), or to their
+// lowercase name. A `config:"-"` tag skips the field. Missing keys leave
+// the field unchanged, unless it has a `default` tag. Nested structs are
+// decoded recursively.
+func decode(c Config, prefix string, v interface{}) error {
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Decode needs a pointer to a struct, got %T", v)
+	}
+
+	var path []string
+	if prefix != "" {
+		path = strings.Split(prefix, ".")
+	}
+
+	var errs []string
+	decodeStruct(c, path, rv.Elem(), &errs)
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func decodeStruct(c Config, path []string, rv reflect.Value, errs *[]string) {
+
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		name := field.Tag.Get("config")
+		if name == "-" {
+			continue
+		} else if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		key := append(append([]string{}, path...), strings.Split(name, ".")...)
+
+		fv := rv.Field(i)
+
+		if fv.Kind() == reflect.Struct && fv.Type() != durationType {
+			decodeStruct(c, key, fv, errs)
+			continue
+		}
+
+		if err := decodeField(c, key, fv, field.Tag); err != nil {
+			*errs = append(*errs, fmt.Sprintf("%s: %s", strings.Join(key, "."), err))
+		}
+	}
+}
+
+func decodeField(c Config, key []string, fv reflect.Value, tag reflect.StructTag) error {
+
+	def, hasDefault := tag.Lookup("default")
+
+	// A missing key falls back to the default, parsed from a string
+	source := c
+	if _, err := c.Get(key...); err != nil {
+		if !hasDefault {
+			return nil
+		}
+		source = defaultConfig(def)
+	}
+
+	switch {
+
+	case fv.Type() == durationType:
+		d, err := source.GetDuration(key...)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+
+	case fv.Kind() == reflect.String:
+		s, err := source.Get(key...)
+		if err != nil {
+			return err
+		}
+		fv.SetString(s)
+
+	case fv.Kind() == reflect.Bool:
+		b, err := source.GetBool(key...)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+
+	case fv.Kind() >= reflect.Int && fv.Kind() <= reflect.Int64:
+		n, err := source.GetInt(key...)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(n))
+
+	case fv.Kind() == reflect.Float32 || fv.Kind() == reflect.Float64:
+		f, err := source.GetFloat(key...)
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+
+	case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.String:
+		list, err := source.GetStringSlice(key...)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(list).Convert(fv.Type()))
+
+	default:
+		return fmt.Errorf("Unsupported type %s", fv.Type())
+	}
+
+	return nil
+}
+
+// defaultConfig is a Config that has the same value for every key
+type defaultConfig string
+
+func (dc defaultConfig) Close() error {
+	return nil
+}
+
+func (dc defaultConfig) Get(key ...string) (string, error) {
+	return string(dc), nil
+}
+
+func (dc defaultConfig) GetInt(key ...string) (int, error) {
+
+	intValue, err := strconv.ParseInt(string(dc), 10, 32)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(intValue), nil
+}
+
+func (dc defaultConfig) GetBool(key ...string) (bool, error) {
+	return getBool(dc, key...)
+}
+
+func (dc defaultConfig) GetFloat(key ...string) (float64, error) {
+	return getFloat(dc, key...)
+}
+
+func (dc defaultConfig) GetDuration(key ...string) (time.Duration, error) {
+	return getDuration(dc, key...)
+}
+
+func (dc defaultConfig) GetStringSlice(key ...string) ([]string, error) {
+	return getStringSlice(dc, key...)
+}
+
+func (dc defaultConfig) Decode(prefix string, v interface{}) error {
+	return decode(dc, prefix, v)
+}
+
+func (dc defaultConfig) Watch(key string, fn func(old, new string)) {
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type decodedBreaker struct {
+	Threshold int           `config:"threshold" default:"5"`
+	Timeout   time.Duration `config:"timeout" default:"30s"`
+}
+
+type decodedOptions struct {
+	Timeout    time.Duration `config:"timeout" default:"2s"`
+	Retries    int           `default:"2"`
+	Ratio      float64
+	Enabled    bool
+	Name       string
+	Providers  []string
+	Breaker    decodedBreaker
+	Threshold  int    `config:"breaker.threshold"`
+	Skipped    string `config:"-"`
+	unexported string
+}
+
+func TestDecode(t *testing.T) {
+
+	tests := []struct {
+		values map[string]string
+		want   decodedOptions
+		err    string
+	}{
+		// Defaults of missing keys, other fields unchanged
+		{
+			values: map[string]string{},
+			want: decodedOptions{
+				Timeout: 2 * time.Second,
+				Retries: 2,
+				Name:    "unchanged",
+				Breaker: decodedBreaker{Threshold: 5, Timeout: 30 * time.Second},
+			},
+		},
+		{
+			values: map[string]string{
+				"upstream.maps.timeout":           "300",
+				"upstream.maps.retries":           "0",
+				"upstream.maps.ratio":             "0.5",
+				"upstream.maps.enabled":           "true",
+				"upstream.maps.name":              "maps",
+				"upstream.maps.providers":         "mapquest, graphhopper",
+				"upstream.maps.breaker.threshold": "3",
+				"upstream.maps.breaker.timeout":   "1.5s",
+				"upstream.maps.skipped":           "set",
+				"upstream.maps.unexported":        "set",
+			},
+			want: decodedOptions{
+				Timeout:   300 * time.Millisecond,
+				Retries:   0,
+				Ratio:     0.5,
+				Enabled:   true,
+				Name:      "maps",
+				Providers: []string{"mapquest", "graphhopper"},
+				Breaker:   decodedBreaker{Threshold: 3, Timeout: 1500 * time.Millisecond},
+				Threshold: 3,
+			},
+		},
+		// All invalid keys are reported
+		{
+			values: map[string]string{
+				"upstream.maps.retries": "two",
+				"upstream.maps.enabled": "maybe",
+			},
+			err: "upstream.maps.retries: ",
+		},
+	}
+
+	for _, test := range tests {
+		options := decodedOptions{Name: "unchanged"}
+
+		err := decode(schemaDefaults(test.values), "upstream.maps", &options)
+
+		if test.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) || !strings.Contains(err.Error(), "upstream.maps.enabled: ") {
+				t.Errorf("decode(%v) error = %v, want both invalid keys", test.values, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("decode(%v): %v", test.values, err)
+		} else if !reflect.DeepEqual(options, test.want) {
+			t.Errorf("decode(%v) = %+v, want %+v", test.values, options, test.want)
+		}
+	}
+}
+
+func TestDecodeNotAStruct(t *testing.T) {
+
+	var n int
+	for _, v := range []interface{}{n, &n, decodedOptions{}} {
+		if err := decode(schemaDefaults{}, "", v); err == nil {
+			t.Errorf("decode(%T) succeeded", v)
+		}
+	}
+}
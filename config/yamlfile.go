@@ -1,19 +1,34 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	log "github.com/sirupsen/logrus"
 	yaml "gopkg.in/yaml.v2"
 )
 
 type yamlObject map[interface{}]interface{}
 
-// yamlFileConfig is a client for reading env variables
+// ReloadInterval is the time between checks of YAML config files for changes
+var ReloadInterval = 5 * time.Second
+
+// yamlFileConfig is a client for reading a YAML file, which is reloaded
+// when it changes (e.g. a ConfigMap mounted in Kubernetes)
 type yamlFileConfig struct {
-	yaml yamlObject
+	filePath string
+
+	mutex    *sync.RWMutex
+	yaml     yamlObject
+	contents []byte
+	watchers map[string][]func(old, new string)
+
+	quit chan bool
 }
 
 // NewYamlFileConfig New creates an yamlFileConfig instance
@@ -23,43 +38,192 @@ func NewYamlFileConfig(filePath string) (Config, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	yamlMap, err := parseYaml(yamlBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	ec := &yamlFileConfig{
+		filePath: filePath,
+		mutex:    &sync.RWMutex{},
+		yaml:     yamlMap,
+		contents: yamlBytes,
+		watchers: make(map[string][]func(old, new string)),
+		quit:     make(chan bool),
+	}
+
+	go ec.poll()
+
+	return ec, nil
+}
+
+func parseYaml(yamlBytes []byte) (yamlObject, error) {
+
 	yamlMap := make(yamlObject)
 
 	if err := yaml.Unmarshal(yamlBytes, &yamlMap); err != nil {
 		return nil, err
 	}
 
-	return &yamlFileConfig{
-		yaml: yamlMap,
-	}, nil
+	return yamlMap, nil
+}
+
+// Name of the source
+func (ec *yamlFileConfig) Name() string {
+	return "yaml"
 }
 
-// Close does nothing for yamlFileConfig
+// Close stops watching the file
 func (ec *yamlFileConfig) Close() error {
+	close(ec.quit)
 	return nil
 }
 
-// Get returns a string for the specified key
+// poll reloads the file every ReloadInterval, until Close is called
+func (ec *yamlFileConfig) poll() {
+
+	ticker := time.NewTicker(ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ec.quit:
+			return
+		case <-ticker.C:
+			ec.reload()
+		}
+	}
+}
+
+// reload replaces the config if the file changed, and notifies watchers
+// of changed keys. A file that cannot be read or parsed is ignored, and
+// the last good config is kept.
+func (ec *yamlFileConfig) reload() {
+
+	yamlBytes, err := ioutil.ReadFile(ec.filePath)
+	if err != nil {
+		log.WithField("file", ec.filePath).Error("Cannot read config file, keeping the last good config: ", err)
+		return
+	}
+
+	ec.mutex.RLock()
+	unchanged := bytes.Equal(yamlBytes, ec.contents)
+	ec.mutex.RUnlock()
+
+	if unchanged {
+		return
+	}
+
+	yamlMap, err := parseYaml(yamlBytes)
+	if err != nil {
+		log.WithField("file", ec.filePath).Error("Cannot parse config file, keeping the last good config: ", err)
+		return
+	}
+
+	type change struct {
+		fns      []func(old, new string)
+		old, new string
+	}
+
+	var changes []change
+
+	ec.mutex.Lock()
+	for key, fns := range ec.watchers {
+		path := strings.Split(key, ".")
+
+		// Missing keys have an empty value, like deleted etcd keys
+		old, _ := yamlGet(ec.yaml, path...)
+		new, _ := yamlGet(yamlMap, path...)
+
+		if old != new {
+			changes = append(changes, change{append([]func(old, new string){}, fns...), old, new})
+		}
+	}
+	ec.yaml = yamlMap
+	ec.contents = yamlBytes
+	ec.mutex.Unlock()
+
+	log.WithField("file", ec.filePath).Info("Reloaded config file")
+
+	for _, c := range changes {
+		for _, fn := range c.fns {
+			fn(c.old, c.new)
+		}
+	}
+}
+
+// Get returns a string for the specified key.
+// Numbers and bools are formatted, lists are joined with commas.
 func (ec *yamlFileConfig) Get(key ...string) (string, error) {
 
-	value, err := ec.getYamlValue(key...)
+	ec.mutex.RLock()
+	root := ec.yaml
+	ec.mutex.RUnlock()
+
+	return yamlGet(root, key...)
+}
+
+func yamlGet(root yamlObject, key ...string) (string, error) {
+
+	value, err := getYamlValue(root, key...)
 	if err != nil {
 		return "", err
 	}
 
+	if list, ok := value.([]interface{}); ok {
+		items, err := yamlStrings(list)
+		if err != nil {
+			return "", err
+		}
+		return strings.Join(items, ","), nil
+	}
+
+	return yamlString(value)
+}
+
+// GetInt returns an int for the specified key
+func (ec *yamlFileConfig) GetInt(key ...string) (int, error) {
+
+	value, err := ec.getYamlValue(key...)
+	if err != nil {
+		return 0, err
+	}
+
 	switch v := value.(type) {
-	case string:
-		return v, nil
 	case int:
-		return strconv.Itoa(v), nil
+		return v, nil
+	case string:
+		intValue, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return 0, err
+		}
+		return int(intValue), nil
 	default:
-		return "", fmt.Errorf("Unsupported type")
+		return 0, fmt.Errorf("Wanted int, got %T", value)
+	}
+}
+
+// GetBool returns a bool for the specified key
+func (ec *yamlFileConfig) GetBool(key ...string) (bool, error) {
 
+	value, err := ec.getYamlValue(key...)
+	if err != nil {
+		return false, err
+	}
+
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		return strconv.ParseBool(v)
+	default:
+		return false, fmt.Errorf("Wanted bool, got %T", value)
 	}
 }
 
-// GetInt returns a string for the specified key converted to a 32 bit integer
-func (ec *yamlFileConfig) GetInt(key ...string) (int, error) {
+// GetFloat returns a float for the specified key
+func (ec *yamlFileConfig) GetFloat(key ...string) (float64, error) {
 
 	value, err := ec.getYamlValue(key...)
 	if err != nil {
@@ -67,27 +231,114 @@ func (ec *yamlFileConfig) GetInt(key ...string) (int, error) {
 	}
 
 	switch v := value.(type) {
+	case float64:
+		return v, nil
 	case int:
+		return float64(v), nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	default:
+		return 0, fmt.Errorf("Wanted float, got %T", value)
+	}
+}
+
+// GetDuration returns a duration for the specified key
+// ("1.5s", "300ms" or milliseconds)
+func (ec *yamlFileConfig) GetDuration(key ...string) (time.Duration, error) {
+	return getDuration(ec, key...)
+}
+
+// GetStringSlice returns a list or a comma-separated string
+// for the specified key
+func (ec *yamlFileConfig) GetStringSlice(key ...string) ([]string, error) {
+
+	value, err := ec.getYamlValue(key...)
+	if err != nil {
+		return nil, err
+	}
+
+	if list, ok := value.([]interface{}); ok {
+		return yamlStrings(list)
+	}
+
+	stringValue, err := yamlString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return splitList(stringValue), nil
+}
+
+// Decode binds the subtree under prefix to a struct
+func (ec *yamlFileConfig) Decode(prefix string, v interface{}) error {
+	return decode(ec, prefix, v)
+}
+
+// Watch calls fn when the value of key changes after the file is reloaded.
+// A removed key has an empty value.
+func (ec *yamlFileConfig) Watch(key string, fn func(old, new string)) {
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+
+	ec.watchers[key] = append(ec.watchers[key], fn)
+}
+
+// yamlString formats a scalar YAML value
+func yamlString(value interface{}) (string, error) {
+
+	switch v := value.(type) {
+	case string:
 		return v, nil
+	case int:
+		return strconv.Itoa(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
 	default:
-		return 0, fmt.Errorf("Wanted int, got string")
+		return "", fmt.Errorf("Unsupported type %T", value)
+	}
+}
+
+func yamlStrings(list []interface{}) ([]string, error) {
 
+	items := make([]string, len(list))
+
+	for i, item := range list {
+		stringValue, err := yamlString(item)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = stringValue
 	}
+
+	return items, nil
 }
 
 func (ec *yamlFileConfig) getYamlValue(key ...string) (interface{}, error) {
 
+	ec.mutex.RLock()
+	root := ec.yaml
+	ec.mutex.RUnlock()
+
+	return getYamlValue(root, key...)
+}
+
+func getYamlValue(root yamlObject, key ...string) (interface{}, error) {
+
 	fullKey := strings.ToLower(strings.Join(key, "."))
 
 	var objPtr interface{}
-	objPtr = ec.yaml
+	objPtr = root
 
 	for idx, k := range key {
 		switch i := objPtr.(type) {
 		case yamlObject:
-			if val, ok := i[k]; ok {
-				objPtr = val
+			val, ok := i[k]
+			if !ok || val == nil {
+				return "", fmt.Errorf("Key not found: %s", fullKey)
 			}
+			objPtr = val
 		default:
 			return "", fmt.Errorf("Key not a YAML object: %s", strings.Join(key[0:idx], "."))
 		}
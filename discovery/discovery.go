@@ -12,15 +12,17 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/nimbo-stratuz/bikeshare-directions/config"
+	"github.com/nimbo-stratuz/bikeshare-directions/tracing"
 	etcd2 "go.etcd.io/etcd/client"
 )
 
 // ServiceDiscovery is an interface for registering service with etcd
 // and discovering other services
 type ServiceDiscovery interface {
-	Register() error                                       // Register running service with etcd
-	Discover(service, env, version string) (string, error) // Discover url of some env/service/version
-	Close()                                                // Close stops refreshing TTL and deregisters the service
+	Register() error                                                            // Register running service with etcd
+	Discover(ctx context.Context, service, env, version string) (string, error) // Discover url of some env/service/version
+	Registered(ctx context.Context) error                                       // Check that the service is still registered with etcd
+	Close()                                                                     // Close stops refreshing TTL and deregisters the service
 }
 
 type discovery struct {
@@ -60,7 +62,7 @@ func New(instanceID string, cfg config.Config) (ServiceDiscovery, error) {
 	return &discovery{
 		instanceID:    instanceID,
 		config:        cfg,
-		kapi:          etcd2.NewKeysAPI(etcd2Client),
+		kapi:          instrumentedKeysAPI{etcd2.NewKeysAPI(etcd2Client)},
 		refresherChan: make(chan bool),
 	}, nil
 }
@@ -184,38 +186,70 @@ func (d *discovery) Deregister() {
 	}
 }
 
-func (d *discovery) Discover(name, env, version string) (string, error) {
+func (d *discovery) Registered(ctx context.Context) error {
+
+	_, err := d.kapi.Get(ctx, d.genPathInstanceURL(), nil)
+	if etcd2.IsKeyNotFound(err) {
+		return NewRegisterError("Service is not registered")
+	} else if err != nil {
+		return NewRegisterError(err.Error())
+	}
+
+	return nil
+}
+
+func (d *discovery) Discover(ctx context.Context, name, env, version string) (string, error) {
 
 	log.Debugf("Discovering service %s|%s|%s", name, env, version)
 
-	instances, err := d.list(name, env, version)
+	ctx, span := tracing.StartSpan(ctx, "discovery.Discover", tracing.KindInternal)
+	defer span.End()
+
+	span.SetAttribute("service.name", name)
+	span.SetAttribute("service.env", env)
+	span.SetAttribute("service.version", version)
+
+	instances, err := d.list(ctx, name, env, version)
 	if err != nil {
-		return "", NewDiscoverError(name, env, version, err.Error())
+		lookups.Inc(name, "error")
+		err := NewDiscoverError(name, env, version, err.Error())
+		span.SetError(err)
+		return "", err
 	} else if len(instances) <= 0 {
-		return "", NewDiscoverError(name, env, version, "No instances registered")
+		lookups.Inc(name, "not_found")
+		err := NewDiscoverError(name, env, version, "No instances registered")
+		span.SetError(err)
+		return "", err
 	}
 
 	idx := rand.Intn(len(instances))
 
 	path := instances[idx] + "/url"
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	ctx, cancel := context.WithTimeout(ctx, time.Second*2)
 	resp, err := d.kapi.Get(ctx, path, nil)
 	defer cancel()
 	if err != nil {
-		return "", NewDiscoverError(name, env, version, err.Error())
+		lookups.Inc(name, "error")
+		err := NewDiscoverError(name, env, version, err.Error())
+		span.SetError(err)
+		return "", err
 	}
 
+	span.SetAttribute("instances", len(instances))
+
+	lookups.Inc(name, "found")
+
 	log.Debugf("Discovered service %s|%s|%s: url %s", name, env, version, resp.Node.Value)
 
 	return resp.Node.Value, nil
 }
 
-func (d *discovery) list(name, env, version string) ([]string, error) {
+func (d *discovery) list(ctx context.Context, name, env, version string) ([]string, error) {
 
 	dir := fmt.Sprintf("/environments/%s/services/%s/%s/instances", env, name, version)
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	ctx, cancel := context.WithTimeout(ctx, time.Second*2)
 	resp, err := d.kapi.Get(ctx, dir, nil)
 	defer cancel()
 
@@ -0,0 +1,50 @@
+package discovery
+
+import (
+	"context"
+	"time"
+
+	etcd2 "go.etcd.io/etcd/client"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/metrics"
+)
+
+var lookups = metrics.NewCounter(
+	"discovery_lookups_total",
+	"Number of service discovery lookups by service and result (found, not_found, error).",
+	"service", "result",
+)
+
+// instrumentedKeysAPI records latency and errors of etcd calls
+type instrumentedKeysAPI struct {
+	etcd2.KeysAPI
+}
+
+func (k instrumentedKeysAPI) Get(ctx context.Context, key string, opts *etcd2.GetOptions) (*etcd2.Response, error) {
+	start := time.Now()
+	resp, err := k.KeysAPI.Get(ctx, key, opts)
+	observe(start, err)
+	return resp, err
+}
+
+func (k instrumentedKeysAPI) Set(ctx context.Context, key, value string, opts *etcd2.SetOptions) (*etcd2.Response, error) {
+	start := time.Now()
+	resp, err := k.KeysAPI.Set(ctx, key, value, opts)
+	observe(start, err)
+	return resp, err
+}
+
+func (k instrumentedKeysAPI) Delete(ctx context.Context, key string, opts *etcd2.DeleteOptions) (*etcd2.Response, error) {
+	start := time.Now()
+	resp, err := k.KeysAPI.Delete(ctx, key, opts)
+	observe(start, err)
+	return resp, err
+}
+
+// observe records an etcd call. Missing keys are a valid response.
+func observe(start time.Time, err error) {
+	if etcd2.IsKeyNotFound(err) {
+		err = nil
+	}
+	metrics.ObserveUpstream("etcd", start, err)
+}
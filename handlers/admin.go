@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/config"
+	"github.com/nimbo-stratuz/bikeshare-directions/logging"
+	"github.com/nimbo-stratuz/bikeshare-directions/models"
+	"github.com/nimbo-stratuz/bikeshare-directions/service"
+)
+
+// AdminAuth allows requests with the bearer token in admin.token.
+// The admin API is disabled if admin.token is not set.
+func AdminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		token, err := service.Config.Get("admin", "token")
+		if err != nil || token == "" {
+			render.Render(w, r, ErrForbidden("The admin API is disabled, admin.token is not set"))
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		given := strings.TrimPrefix(auth, "Bearer ")
+
+		if !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			render.Render(w, r, ErrUnauthorized("Missing or invalid bearer token"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AdminConfig lists the config keys of the service, with their
+// effective value and the source that provides it
+func AdminConfig(w http.ResponseWriter, r *http.Request) {
+
+	schema := service.ConfigSchema()
+
+	entries := make([]*models.ConfigEntry, len(schema))
+	for i, field := range schema {
+		entries[i] = configEntry(field.Key)
+	}
+
+	render.Render(w, r, &models.ConfigEntries{Entries: entries})
+}
+
+// PutAdminConfig sets a config key in etcd (service.WritableConfig)
+func PutAdminConfig(w http.ResponseWriter, r *http.Request) {
+
+	key := chi.URLParam(r, "key")
+
+	value := &models.ConfigValue{}
+	if err := render.Bind(r, value); err != nil {
+		render.Render(w, r, ErrValidation(err.Error()))
+		return
+	}
+
+	logger := logging.FromContext(r.Context()).WithField("key", key)
+
+	err := service.SetConfig(key, *value.Value)
+
+	switch err.(type) {
+	case nil:
+		logger.Info("Config set through the admin API")
+		render.Render(w, r, configEntry(key))
+	case *service.UnknownConfigKeyError:
+		render.Render(w, r, ErrUnknownConfigKey(err.Error()))
+	case *config.ValidationError:
+		render.Render(w, r, ErrValidation(err.Error()))
+	case *service.OverriddenConfigKeyError:
+		render.Render(w, r, ErrConflict(err.Error()))
+	default:
+		logger.Warn("Cannot set config: ", err)
+		render.Render(w, r, ErrUpstreamUnavailable("Cannot write to etcd"))
+	}
+}
+
+// configEntry returns the effective value of key, with secrets redacted
+func configEntry(key string) *models.ConfigEntry {
+
+	entry := service.DescribeConfig(key, false)
+
+	return &models.ConfigEntry{
+		Key:      entry.Key,
+		Value:    entry.Value,
+		Source:   entry.Source,
+		Writable: entry.Writable,
+	}
+}
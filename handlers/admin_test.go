@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/config"
+	"github.com/nimbo-stratuz/bikeshare-directions/models"
+	"github.com/nimbo-stratuz/bikeshare-directions/service"
+)
+
+func TestPutAdminConfigProblems(t *testing.T) {
+
+	// No values are set
+	service.Config = config.NewEnvConfig("HANDLERS_TEST_")
+
+	router := chi.NewRouter()
+	router.Put("/admin/config/{key}", PutAdminConfig)
+
+	tests := []struct {
+		key    string
+		body   string
+		status int
+		code   string
+	}{
+		{"maps.api.secret", `{"value": "x"}`, http.StatusNotFound, CodeUnknownConfigKey},
+		{"server.port", `{"value": "http"}`, http.StatusBadRequest, CodeValidation},
+		{"server.port", `{}`, http.StatusBadRequest, CodeValidation},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("PUT", "/admin/config/"+test.key, strings.NewReader(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		p := &models.Problem{}
+		if err := json.NewDecoder(rec.Body).Decode(p); err != nil {
+			t.Fatalf("PUT %s: %v", test.key, err)
+		}
+
+		if rec.Code != test.status || p.Code != test.code {
+			t.Errorf("PUT %s %s = %d %s, want %d %s", test.key, test.body, rec.Code, p.Code, test.status, test.code)
+		}
+		if p.Type != "/problems/"+strings.ToLower(strings.Replace(test.code, "_", "-", -1)) {
+			t.Errorf("PUT %s %s type = %s", test.key, test.body, p.Type)
+		}
+	}
+}
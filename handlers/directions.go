@@ -1,12 +1,10 @@
 package handlers
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
-	"net/url"
-	"time"
+	"sync"
 
 	"github.com/go-chi/chi/middleware"
 
@@ -14,7 +12,12 @@ import (
 
 	"github.com/go-chi/render"
 
+	"github.com/nimbo-stratuz/bikeshare-directions/catalogue"
+	"github.com/nimbo-stratuz/bikeshare-directions/health"
+	"github.com/nimbo-stratuz/bikeshare-directions/logging"
+	"github.com/nimbo-stratuz/bikeshare-directions/routing"
 	"github.com/nimbo-stratuz/bikeshare-directions/service"
+	"github.com/nimbo-stratuz/bikeshare-directions/upstream"
 
 	"github.com/nimbo-stratuz/bikeshare-directions/models"
 )
@@ -22,119 +25,240 @@ import (
 // DirectionsFromTo ...
 func DirectionsFromTo() http.HandlerFunc {
 
-	apiKey, err := service.Config.Get("maps", "api", "key")
+	timeout := service.GetUpstreamTimeout()
+
+	providers, err := newProvider()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	mapsURL := fmt.Sprintf("https://www.mapquestapi.com/directions/v2/route?key=%s", apiKey)
+	swappable := routing.NewSwappable(providers)
+	watchProviderConfig(swappable)
+
+	provider := routing.NewCoalescing(
+		routing.NewCached(
+			swappable,
+			service.Cache,
+			service.GetCacheTTL(),
+		),
+	)
 
-	client := &http.Client{
-		Timeout: time.Millisecond * 2500,
+	catalogueOptions, err := service.GetUpstreamOptions("catalogue")
+	if err != nil {
+		log.Fatal(err)
 	}
+	catalogueOptions.PropagateDeadline = true
+	catalogueOptions.PropagateTrace = true
 
-	return func(w http.ResponseWriter, r *http.Request) {
+	// Directions cannot be served without the catalogue
+	health.Register(
+		upstream.NewBreakerCheck("CatalogueCircuitBreakerHealthCheck", "catalogue"),
+		health.Options{},
+	)
 
-		var (
-			bycicle models.Bicycle    = models.Bicycle{}
-			route   models.Directions = models.Directions{}
-		)
+	health.Register(
+		health.NewChecker("CatalogueDiscoveryHealthCheck", func(ctx context.Context) error {
+			_, err := catalogue.Discover(ctx, service.Discovery, service.GetEnv())
+			return err
+		}),
+		service.GetHealthOptions("catalogue"),
+	)
+
+	catalogueClient := catalogue.NewCoalescing(
+		catalogue.New(
+			service.Discovery,
+			service.GetEnv(),
+			upstream.New("catalogue", catalogueOptions),
+		),
+	)
+
+	return func(w http.ResponseWriter, r *http.Request) {
 
 		fromTo := &models.FromTo{}
 
 		if err := render.Bind(r, fromTo); err != nil {
-			render.Render(w, r, ErrBadRequest("From/to not specified"))
+			render.Render(w, r, ErrValidation(err.Error()))
 			return
 		}
 
-		// GET route
-		{
-			directionsBody := models.DirectionsRequest{
-				Locations: []string{fromTo.From, fromTo.To},
-				Options: models.DirectionsRequestOptions{
-					RouteType: "bicycle",
-					Unit:      "k",
-				},
-			}
+		// All upstream calls share a single deadline
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
 
-			body := new(bytes.Buffer)
-			if err := json.NewEncoder(body).Encode(directionsBody); err != nil {
-				log.Print("MapsQuest request/Encode:", err)
-				render.Render(w, r, ErrServerError())
+		// Resolve the origin, unless it is given as coordinates
+		origin, ok := routing.ParseLatLng(fromTo.From)
+		if !ok {
+			var err error
+			if origin, err = provider.Geocode(ctx, fromTo.From); err != nil {
+				logging.FromContext(ctx).Warn("Cannot resolve origin: ", err)
+				render.Render(w, r, ErrUpstream(err))
 				return
 			}
+		}
 
-			resp, err := client.Post(mapsURL, "application/json; charset=utf-8", body)
-			if err != nil {
-				log.Print(err)
-				render.Render(w, r, Err(503, "Maps API unavaliable"))
-				return
-			}
-			defer resp.Body.Close()
+		// GET route and closest bicycle concurrently.
+		// The first failure cancels the other call.
+		var (
+			route       *models.Directions
+			bicycle     *models.Bicycle
+			unavailable *models.BicycleUnavailable
 
-			if err := json.NewDecoder(resp.Body).Decode(&route); err != nil {
-				log.Println("MapsQuest response/Decode:", err)
-				render.Render(w, r, ErrServerError())
-				return
-			}
+			wg       sync.WaitGroup
+			errMutex sync.Mutex
+			firstErr error
+		)
 
-			if route.Info.Statuscode != 0 {
-				log.Printf("MapsQuest API Error code = %d\n", route.Info.Statuscode)
-				render.Render(w, r, Err(503, "Maps API Error"))
-				return
+		fail := func(err error) {
+			errMutex.Lock()
+			defer errMutex.Unlock()
+
+			if firstErr == nil {
+				firstErr = err
+				cancel()
 			}
 		}
 
-		// GET closest bicycle
-		{
-			catalogueURLString, err := service.Discovery.Discover("bikeshare-catalogue", service.GetEnv(), "1.0.0")
-			if err != nil {
-				log.Println(err)
-				render.Render(w, r, ErrServerError())
-				return
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			var err error
+			if route, err = provider.Route(ctx, fromTo.From, fromTo.To); err != nil {
+				fail(err)
 			}
+		}()
 
-			catalogueURL, err := url.Parse(catalogueURLString + "/v1/bicycles")
-			if err != nil {
-				log.Println(err)
-				render.Render(w, r, ErrServerError())
-				return
+		go func() {
+			defer wg.Done()
+
+			var err error
+			bicycle, err = catalogueClient.ClosestBicycle(
+				ctx,
+				fmt.Sprint(r.Context().Value(middleware.RequestIDKey)),
+				origin.Lat,
+				origin.Lng,
+			)
+			if noBicycle, ok := err.(*catalogue.NoBicycleError); ok {
+				// Directions are still useful without a bicycle
+				unavailable = &models.BicycleUnavailable{
+					Code:   CodeNoBicycle,
+					Reason: noBicycle.Reason(),
+				}
+			} else if err != nil {
+				fail(err)
 			}
+		}()
+
+		wg.Wait()
 
-			query := catalogueURL.Query()
+		if firstErr != nil {
+			logging.FromContext(ctx).Warn("Cannot plan trip: ", firstErr)
+			render.Render(w, r, ErrUpstream(firstErr))
+			return
+		}
 
-			query.Set("latitude", fmt.Sprint(route.Route.Locations[0].LatLng.Lat))
-			query.Set("longitude", fmt.Sprint(route.Route.Locations[0].LatLng.Lng))
+		render.Render(w, r, &models.DirectionsWithBicycle{
+			Bicycle:            bicycle,
+			BicycleUnavailable: unavailable,
+			Directions:         route,
+		})
+	}
+}
 
-			catalogueURL.RawQuery = query.Encode()
+// newProvider creates the routing providers listed in routing.providers
+// (in priority order), with failover between them. Transactions with
+// each provider are metered against its quota and traced.
+func newProvider() (routing.Provider, error) {
 
-			req, err := http.NewRequest("GET", catalogueURL.String(), nil)
+	var providers []routing.Provider
+	var upstreams []string
+
+	for _, name := range service.GetRoutingProviders() {
+		var provider routing.Provider
+
+		switch name {
+
+		case "mapquest":
+			apiKey, err := service.Config.Get("maps", "api", "key")
 			if err != nil {
-				log.Println(err)
-				render.Render(w, r, ErrServerError())
-				return
+				return nil, err
 			}
 
-			req.Header.Set("X-Request-ID", fmt.Sprint(r.Context().Value(middleware.RequestIDKey)))
+			options, err := service.GetUpstreamOptions("maps")
+			if err != nil {
+				return nil, err
+			}
+
+			provider = routing.NewMapQuest(apiKey, upstream.New("maps", options))
+			upstreams = append(upstreams, "maps")
 
-			resp, err := client.Do(req)
+		case "graphhopper":
+			apiKey, err := service.Config.Get("graphhopper", "api", "key")
 			if err != nil {
-				log.Println(err)
-				render.Render(w, r, ErrServerError())
-				return
+				return nil, err
 			}
-			defer resp.Body.Close()
 
-			if err := json.NewDecoder(resp.Body).Decode(&bycicle); err != nil {
-				log.Println(err)
-				render.Render(w, r, ErrServerError())
-				return
+			options, err := service.GetUpstreamOptions("graphhopper")
+			if err != nil {
+				return nil, err
 			}
+
+			provider = routing.NewGraphHopper(apiKey, upstream.New("graphhopper", options))
+			upstreams = append(upstreams, "graphhopper")
+
+		default:
+			return nil, fmt.Errorf("Unknown routing provider: %s", name)
 		}
 
-		render.Render(w, r, &models.DirectionsWithBicycle{
-			Bicycle:    &bycicle,
-			Directions: &route,
-		})
+		providers = append(providers, routing.NewTraced(routing.NewMetered(provider, service.Quota)))
+	}
+
+	// With failover, routes can be computed while any breaker is not open.
+	// Replaces the check of the previous providers.
+	health.Register(
+		upstream.NewBreakerCheck("RoutingCircuitBreakerHealthCheck", upstreams...),
+		health.Options{},
+	)
+
+	return routing.NewFailover(providers...), nil
+}
+
+// providerKeys are the config keys newProvider depends on
+func providerKeys() []string {
+
+	keys := []string{"routing.providers", "maps.api.key", "graphhopper.api.key"}
+
+	for _, name := range []string{"maps", "graphhopper"} {
+		for _, option := range []string{"timeout", "retries", "backoff", "maxbackoff", "breaker.threshold", "breaker.timeout"} {
+			keys = append(keys, "upstream."+name+"."+option)
+		}
+	}
+
+	return keys
+}
+
+// watchProviderConfig recreates the routing providers when their
+// configuration changes. Invalid changes keep the current providers.
+func watchProviderConfig(swappable *routing.Swappable) {
+
+	mutex := &sync.Mutex{}
+
+	reload := func(old, new string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		provider, err := newProvider()
+		if err != nil {
+			log.Error("Cannot reload routing providers, keeping the current ones: ", err)
+			return
+		}
+
+		swappable.Swap(provider)
+		log.Info("Reloaded routing providers")
+	}
+
+	for _, key := range providerKeys() {
+		service.Config.Watch(key, reload)
 	}
 }
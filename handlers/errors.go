@@ -1,24 +1,191 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
 	"github.com/go-chi/render"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/catalogue"
+	"github.com/nimbo-stratuz/bikeshare-directions/discovery"
 	"github.com/nimbo-stratuz/bikeshare-directions/models"
+	"github.com/nimbo-stratuz/bikeshare-directions/routing"
+	"github.com/nimbo-stratuz/bikeshare-directions/upstream"
+)
+
+// Error codes returned in Problem responses. They are part of the API
+// and must not change.
+const (
+	CodeValidation          = "VALIDATION_FAILED"
+	CodeNotFound            = "NOT_FOUND"
+	CodeAmbiguousLocation   = "LOCATION_AMBIGUOUS"
+	CodeNoBicycle           = "NO_BICYCLE_AVAILABLE"
+	CodeUpstreamUnavailable = "UPSTREAM_UNAVAILABLE"
+	CodeUpstreamRejected    = "UPSTREAM_REJECTED"
+	CodeUnauthorized        = "UNAUTHORIZED"
+	CodeForbidden           = "FORBIDDEN"
+	CodeConflict            = "CONFLICT"
+	CodeUnknownConfigKey    = "UNKNOWN_CONFIG_KEY"
+	CodeInternal            = "INTERNAL_ERROR"
 )
 
-// ErrBadRequest creates an ErrResponse for 400 Bad Request
+func init() {
+	render.Respond = respond
+}
+
+// respond writes Problems as application/problem+json
+// and everything else with the default responder
+func respond(w http.ResponseWriter, r *http.Request, v interface{}) {
+
+	if _, ok := v.(*models.Problem); !ok {
+		render.DefaultResponder(w, r, v)
+		return
+	}
+
+	body, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	if status, ok := r.Context().Value(render.StatusCtxKey).(int); ok {
+		w.WriteHeader(status)
+	}
+	w.Write(body)
+}
+
+// ErrValidation creates a Problem for invalid requests
+func ErrValidation(detail string) render.Renderer {
+	return problem(http.StatusBadRequest, CodeValidation, "Invalid request", detail)
+}
+
+// ErrNotFound creates a Problem for locations that cannot be resolved
+func ErrNotFound(detail string) render.Renderer {
+	return problem(http.StatusNotFound, CodeNotFound, "Location not found", detail)
+}
+
+// ErrAmbiguousLocation creates a Problem for locations that can only be
+// resolved coarsely, listing possible matches
+func ErrAmbiguousLocation(detail string, candidates []models.LocationCandidate) render.Renderer {
+	p := problem(http.StatusUnprocessableEntity, CodeAmbiguousLocation, "Location is ambiguous", detail)
+	p.Candidates = candidates
+	return p
+}
+
+// ErrNoBicycle creates a Problem for when there is no bicycle available
+func ErrNoBicycle(detail string) render.Renderer {
+	return problem(http.StatusNotFound, CodeNoBicycle, "No bicycle available", detail)
+}
+
+// ErrUpstreamUnavailable creates a Problem for upstream services
+// that cannot be reached in time
+func ErrUpstreamUnavailable(detail string) render.Renderer {
+	return problem(http.StatusServiceUnavailable, CodeUpstreamUnavailable, "Upstream service unavailable", detail)
+}
+
+// ErrUpstreamRejected creates a Problem for upstream services
+// that rejected a request
+func ErrUpstreamRejected(detail string) render.Renderer {
+	return problem(http.StatusBadGateway, CodeUpstreamRejected, "Upstream service rejected the request", detail)
+}
+
+// ErrUnauthorized creates a Problem for requests without valid credentials
+func ErrUnauthorized(detail string) render.Renderer {
+	return problem(http.StatusUnauthorized, CodeUnauthorized, "Unauthorized", detail)
+}
+
+// ErrForbidden creates a Problem for requests that are not allowed
+func ErrForbidden(detail string) render.Renderer {
+	return problem(http.StatusForbidden, CodeForbidden, "Forbidden", detail)
+}
+
+// ErrConflict creates a Problem for requests conflicting with
+// the current state
+func ErrConflict(detail string) render.Renderer {
+	return problem(http.StatusConflict, CodeConflict, "Conflict", detail)
+}
+
+// ErrUnknownConfigKey creates a Problem for config keys that are not
+// declared in the schema
+func ErrUnknownConfigKey(detail string) render.Renderer {
+	return problem(http.StatusNotFound, CodeUnknownConfigKey, "Unknown config key", detail)
+}
+
+// ErrBadRequest creates a Problem for 400 Bad Request
 func ErrBadRequest(message string) render.Renderer {
-	return Err(400, message)
+	return ErrValidation(message)
 }
 
-// ErrServerError creates an ErrResponse for Server Errors
+// ErrServerError creates a Problem for Server Errors
 func ErrServerError() render.Renderer {
-	return Err(500, "Internal Server Error")
+	return problem(http.StatusInternalServerError, CodeInternal, "Internal Server Error", "")
 }
 
-// Err creates an ErrResponse
+// Err creates a Problem with the specified status and the code of its
+// constructor. Statuses whose meaning depends on the request (e.g. 404)
+// have no generic code and are Server Errors; use their constructor.
 func Err(status int, message string) render.Renderer {
-	return &models.ErrResponse{
-		StatusCode: 500,
-		ErrorText:  message,
+
+	switch status {
+	case http.StatusBadRequest:
+		return ErrValidation(message)
+	case http.StatusUnauthorized:
+		return ErrUnauthorized(message)
+	case http.StatusForbidden:
+		return ErrForbidden(message)
+	case http.StatusConflict:
+		return ErrConflict(message)
+	case http.StatusBadGateway:
+		return ErrUpstreamRejected(message)
+	case http.StatusServiceUnavailable:
+		return ErrUpstreamUnavailable(message)
+	default:
+		return ErrServerError()
+	}
+}
+
+// Details of upstream Problems. Errors of upstream calls are only logged,
+// they may contain URLs with API keys and internal addresses.
+const (
+	detailUpstreamTimeout     = "Upstream services did not respond in time"
+	detailUpstreamUnavailable = "A routing provider or bikeshare-catalogue is unavailable, try again later"
+	detailUpstreamRejected    = "A routing provider or bikeshare-catalogue rejected the request"
+)
+
+// ErrUpstream creates a Problem for errors returned by routing providers
+// and bikeshare-catalogue. Unknown errors are treated as Server Errors.
+func ErrUpstream(err error) render.Renderer {
+
+	if err == context.DeadlineExceeded {
+		return ErrUpstreamUnavailable(detailUpstreamTimeout)
+	}
+
+	switch e := err.(type) {
+	case *routing.AmbiguousLocationError:
+		return ErrAmbiguousLocation(e.Error(), e.Candidates)
+	case *routing.UnavailableError, *routing.QuotaExceededError,
+		*catalogue.UnavailableError, *discovery.DiscoverError, *upstream.CircuitOpenError:
+		return ErrUpstreamUnavailable(detailUpstreamUnavailable)
+	case *routing.StatusError, *catalogue.RejectedError:
+		return ErrUpstreamRejected(detailUpstreamRejected)
+	case *routing.NotFoundError:
+		return ErrNotFound(err.Error())
+	case *catalogue.NoBicycleError:
+		return ErrNoBicycle(err.Error())
+	default:
+		return ErrServerError()
+	}
+}
+
+func problem(status int, code, title, detail string) *models.Problem {
+	return &models.Problem{
+		Type:   "/problems/" + strings.ToLower(strings.Replace(code, "_", "-", -1)),
+		Title:  title,
+		Status: status,
+		Code:   code,
+		Detail: detail,
 	}
 }
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/catalogue"
+	"github.com/nimbo-stratuz/bikeshare-directions/models"
+	"github.com/nimbo-stratuz/bikeshare-directions/routing"
+	"github.com/nimbo-stratuz/bikeshare-directions/upstream"
+)
+
+func TestErrUpstream(t *testing.T) {
+
+	const apiKey = "s3cr3t-api-key"
+
+	// An error of the http package, with the API key in the URL
+	urlErr := &url.Error{
+		Op:  "Get",
+		URL: "https://www.mapquestapi.com/directions/v2/route?key=" + apiKey,
+		Err: errors.New("dial tcp: i/o timeout"),
+	}
+
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{context.DeadlineExceeded, http.StatusServiceUnavailable, CodeUpstreamUnavailable},
+		{routing.NewUnavailableError("mapquest", upstream.StripURL(urlErr).Error()), http.StatusServiceUnavailable, CodeUpstreamUnavailable},
+		{routing.NewUnavailableError("mapquest", urlErr.Error()), http.StatusServiceUnavailable, CodeUpstreamUnavailable},
+		{routing.NewQuotaExceededError("mapquest", "hard"), http.StatusServiceUnavailable, CodeUpstreamUnavailable},
+		{catalogue.NewUnavailableError(urlErr.Error()), http.StatusServiceUnavailable, CodeUpstreamUnavailable},
+		{upstream.NewCircuitOpenError("maps"), http.StatusServiceUnavailable, CodeUpstreamUnavailable},
+		{routing.NewStatusError("mapquest", 403), http.StatusBadGateway, CodeUpstreamRejected},
+		{catalogue.NewRejectedError(400), http.StatusBadGateway, CodeUpstreamRejected},
+		{routing.NewNotFoundError("mapquest", "Nowhere"), http.StatusNotFound, CodeNotFound},
+		{routing.NewAmbiguousLocationError("mapquest", "Ljubljana", nil), http.StatusUnprocessableEntity, CodeAmbiguousLocation},
+		{catalogue.NewNoBicycleError("none nearby"), http.StatusNotFound, CodeNoBicycle},
+		{errors.New("unexpected"), http.StatusInternalServerError, CodeInternal},
+	}
+
+	for _, test := range tests {
+		p := ErrUpstream(test.err).(*models.Problem)
+
+		if p.Status != test.status || p.Code != test.code {
+			t.Errorf("ErrUpstream(%T) = %d %s, want %d %s", test.err, p.Status, p.Code, test.status, test.code)
+		}
+
+		if strings.Contains(p.Detail, apiKey) || strings.Contains(p.Detail, "key=") {
+			t.Errorf("ErrUpstream(%T) detail leaks the URL: %s", test.err, p.Detail)
+		}
+	}
+}
+
+func TestErr(t *testing.T) {
+
+	tests := []struct {
+		status int
+		want   int
+		code   string
+	}{
+		{http.StatusBadRequest, http.StatusBadRequest, CodeValidation},
+		{http.StatusUnauthorized, http.StatusUnauthorized, CodeUnauthorized},
+		{http.StatusForbidden, http.StatusForbidden, CodeForbidden},
+		{http.StatusConflict, http.StatusConflict, CodeConflict},
+		{http.StatusBadGateway, http.StatusBadGateway, CodeUpstreamRejected},
+		{http.StatusServiceUnavailable, http.StatusServiceUnavailable, CodeUpstreamUnavailable},
+		{http.StatusNotFound, http.StatusInternalServerError, CodeInternal},
+		{http.StatusTeapot, http.StatusInternalServerError, CodeInternal},
+		{http.StatusInternalServerError, http.StatusInternalServerError, CodeInternal},
+	}
+
+	for _, test := range tests {
+		p := Err(test.status, "message").(*models.Problem)
+
+		if p.Status != test.want || p.Code != test.code {
+			t.Errorf("Err(%d) = %d %s, want %d %s", test.status, p.Status, p.Code, test.want, test.code)
+		}
+	}
+}
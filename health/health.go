@@ -0,0 +1,216 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// States of a check (MicroProfile Health)
+const (
+	StateUp   = "UP"
+	StateDown = "DOWN"
+)
+
+// HealthChecker checks a dependency of the service.
+// Check returns additional data about the dependency (may be nil),
+// and an error if it is not usable.
+type HealthChecker interface {
+	Name() string
+	Check(ctx context.Context) (map[string]interface{}, error)
+}
+
+// Options configure a registered HealthChecker
+type Options struct {
+	Timeout time.Duration // Time after which the check is DOWN (default 1s)
+	TTL     time.Duration // Time the result is reused (0 runs the check every time)
+}
+
+// Result is the outcome of a single check
+type Result struct {
+	Name  string
+	State string
+	Data  map[string]interface{}
+}
+
+// Registry runs registered checks
+type Registry struct {
+	mutex  *sync.Mutex
+	checks []*check
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{mutex: &sync.Mutex{}}
+}
+
+// Default is the registry of readiness checks
+var Default = NewRegistry()
+
+// Register adds a checker to the Default registry
+func Register(checker HealthChecker, options Options) {
+	Default.Register(checker, options)
+}
+
+// Register adds a checker. A checker with the same name replaces
+// the previous one.
+func (r *Registry) Register(checker HealthChecker, options Options) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if options.Timeout <= 0 {
+		options.Timeout = time.Second
+	}
+
+	chk := &check{
+		checker: checker,
+		options: options,
+		mutex:   &sync.Mutex{},
+	}
+
+	for i, c := range r.checks {
+		if c.checker.Name() == checker.Name() {
+			r.checks[i] = chk
+			return
+		}
+	}
+
+	r.checks = append(r.checks, chk)
+}
+
+// Check runs all checks concurrently, in registration order of results.
+// The outcome is DOWN if any check is DOWN.
+func (r *Registry) Check() (string, []Result) {
+	r.mutex.Lock()
+	checks := append([]*check(nil), r.checks...)
+	r.mutex.Unlock()
+
+	results := make([]Result, len(checks))
+
+	var wg sync.WaitGroup
+	wg.Add(len(checks))
+
+	for i, chk := range checks {
+		go func(i int, chk *check) {
+			defer wg.Done()
+			results[i] = chk.run()
+		}(i, chk)
+	}
+
+	wg.Wait()
+
+	outcome := StateUp
+	for _, result := range results {
+		if result.State == StateDown {
+			outcome = StateDown
+		}
+	}
+
+	return outcome, results
+}
+
+// check is a registered HealthChecker with its last result
+type check struct {
+	checker HealthChecker
+	options Options
+
+	mutex       *sync.Mutex
+	result      Result
+	checked     time.Time
+	lastError   error
+	lastErrorAt time.Time
+}
+
+var errTimeout = errors.New("Health check timed out")
+
+// run returns the cached result, or runs the check if it has expired.
+// Checks that ignore their context are abandoned after the timeout.
+func (c *check) run() Result {
+
+	c.mutex.Lock()
+	if !c.checked.IsZero() && time.Since(c.checked) < c.options.TTL {
+		defer c.mutex.Unlock()
+		return c.result
+	}
+	c.mutex.Unlock()
+
+	// Probes must not be cut short by the caller
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.Timeout)
+	defer cancel()
+
+	type outcome struct {
+		data map[string]interface{}
+		err  error
+	}
+
+	done := make(chan outcome, 1)
+	start := time.Now()
+
+	go func() {
+		data, err := c.checker.Check(ctx)
+		done <- outcome{data, err}
+	}()
+
+	var out outcome
+	select {
+	case out = <-done:
+	case <-ctx.Done():
+		out.err = errTimeout
+	}
+
+	latency := time.Since(start)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	result := Result{
+		Name:  c.checker.Name(),
+		State: StateUp,
+		Data:  make(map[string]interface{}, len(out.data)+4),
+	}
+
+	for k, v := range out.data {
+		result.Data[k] = v
+	}
+	result.Data["latencyMs"] = latency.Nanoseconds() / int64(time.Millisecond)
+
+	if out.err != nil {
+		log.WithField("check", result.Name).Warn("Health check failed: ", out.err)
+
+		result.State = StateDown
+		c.lastError = out.err
+		c.lastErrorAt = time.Now()
+	}
+
+	if c.lastError != nil {
+		result.Data["lastError"] = c.lastError.Error()
+		result.Data["lastErrorAt"] = c.lastErrorAt.Format(time.RFC3339)
+	}
+
+	c.result = result
+	c.checked = time.Now()
+
+	return result
+}
+
+// funcChecker is a HealthChecker backed by a function
+type funcChecker struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// NewChecker creates a HealthChecker that is DOWN when check fails
+func NewChecker(name string, check func(ctx context.Context) error) HealthChecker {
+	return &funcChecker{name: name, check: check}
+}
+
+func (fc *funcChecker) Name() string {
+	return fc.name
+}
+
+func (fc *funcChecker) Check(ctx context.Context) (map[string]interface{}, error) {
+	return nil, fc.check(ctx)
+}
@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	log "github.com/sirupsen/logrus"
+)
+
+// AccessLog logs every request with the request-scoped logger.
+// Server errors are logged as warnings.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		logger := FromContext(r.Context()).WithFields(log.Fields{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      status,
+			"bytes":       ww.BytesWritten(),
+			"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+			"remote_addr": r.RemoteAddr,
+			"user_agent":  r.UserAgent(),
+		})
+
+		if status >= 500 {
+			logger.Warn("Request failed")
+		} else {
+			logger.Info("Request served")
+		}
+	})
+}
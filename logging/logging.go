@@ -0,0 +1,120 @@
+package logging
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+)
+
+type loggerKey struct{}
+
+// NewContext returns a context carrying logger
+func NewContext(ctx context.Context, logger *log.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// WithFields returns a context whose logger has additional fields
+func WithFields(ctx context.Context, fields log.Fields) context.Context {
+	return NewContext(ctx, FromContext(ctx).WithFields(fields))
+}
+
+// FromContext returns the request-scoped logger, or the standard logger
+// if ctx does not carry one. Once the request is routed, log lines
+// include the route pattern.
+func FromContext(ctx context.Context) *log.Entry {
+
+	logger, ok := ctx.Value(loggerKey{}).(*log.Entry)
+	if !ok {
+		logger = log.NewEntry(log.StandardLogger())
+	}
+
+	if route := Route(ctx); route != "" {
+		logger = logger.WithField("route", route)
+	}
+
+	return logger
+}
+
+// Route returns the pattern of the route matched by chi, or an empty
+// string if the request is not routed (yet)
+func Route(ctx context.Context) string {
+
+	// chi.RouteContext panics outside of a router
+	rctx, ok := ctx.Value(chi.RouteCtxKey).(*chi.Context)
+	if !ok || rctx.RoutePattern() == "" {
+		return ""
+	}
+
+	return cleanPattern(rctx.RoutePattern())
+}
+
+// cleanPattern removes empty segments that mounted routers
+// leave in route patterns ("/v1/directions//" is "/v1/directions")
+func cleanPattern(pattern string) string {
+
+	for strings.Contains(pattern, "//") {
+		pattern = strings.Replace(pattern, "//", "/", -1)
+	}
+
+	if len(pattern) > 1 {
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+
+	return pattern
+}
+
+// fields are added to every log line of the standard logger
+var fields = log.Fields{}
+
+// AddFields adds fields (e.g. the instance id) to every log line of
+// the standard logger. It is not safe for concurrent use.
+func AddFields(f log.Fields) {
+	for k, v := range f {
+		fields[k] = v
+	}
+
+	SetFormatter(log.StandardLogger().Formatter)
+}
+
+// SetFormatter sets the formatter of the standard logger, keeping
+// the fields added with AddFields
+func SetFormatter(formatter log.Formatter) {
+	if ff, ok := formatter.(*fieldsFormatter); ok {
+		formatter = ff.formatter
+	}
+
+	log.SetFormatter(&fieldsFormatter{formatter: formatter})
+}
+
+// fieldsFormatter adds fields to log lines and redacts secrets before
+// formatting them. Hooks cannot be used, since entries share their Data
+// with other goroutines logging through the same *log.Entry.
+type fieldsFormatter struct {
+	formatter log.Formatter
+}
+
+func (ff *fieldsFormatter) Format(entry *log.Entry) ([]byte, error) {
+
+	data := make(log.Fields, len(fields)+len(entry.Data))
+	for k, v := range fields {
+		data[k] = v
+	}
+	for k, v := range entry.Data {
+		switch value := v.(type) {
+		case string:
+			data[k] = Redact(value)
+		case error:
+			data[k] = Redact(value.Error())
+		default:
+			data[k] = v
+		}
+	}
+
+	e := *entry
+	e.Data = data
+	e.Message = Redact(entry.Message)
+
+	return ff.formatter.Format(&e)
+}
@@ -0,0 +1,96 @@
+package logging
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces secret values in log lines
+const Redacted = "[REDACTED]"
+
+// Values shorter than this are not redacted, since they would match
+// too much of unrelated text
+const minSecretLength = 4
+
+var (
+	secretsMutex = &sync.RWMutex{}
+	added        = map[string]bool{}   // Values of AddSecret
+	named        = map[string]string{} // Values of SetSecret, keyed by name
+	secrets      []string              // Longest first, so that longer secrets are replaced whole
+)
+
+// AddSecret makes Redact (and so every log line of the standard
+// logger) replace value with Redacted
+func AddSecret(value string) {
+
+	if len(value) < minSecretLength {
+		return
+	}
+
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+
+	if added[value] {
+		return
+	}
+
+	added[value] = true
+	updateSecrets()
+}
+
+// SetSecret makes Redact replace value, the current value of a secret
+// with the specified name (e.g. "secrets:maps.api.key"), instead of its
+// previous value. Rotated secrets are not kept.
+func SetSecret(name, value string) {
+
+	secretsMutex.RLock()
+	current, ok := named[name]
+	secretsMutex.RUnlock()
+
+	if ok && current == value {
+		return
+	}
+
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+
+	named[name] = value
+	updateSecrets()
+}
+
+// updateSecrets rebuilds secrets. Must be called with secretsMutex locked.
+func updateSecrets() {
+
+	unique := make(map[string]bool, len(added)+len(named))
+	for value := range added {
+		unique[value] = true
+	}
+	for _, value := range named {
+		if len(value) >= minSecretLength {
+			unique[value] = true
+		}
+	}
+
+	list := make([]string, 0, len(unique))
+	for value := range unique {
+		list = append(list, value)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return len(list[i]) > len(list[j])
+	})
+
+	secrets = list
+}
+
+// Redact replaces the values added with AddSecret in s
+func Redact(s string) string {
+	secretsMutex.RLock()
+	defer secretsMutex.RUnlock()
+
+	for _, secret := range secrets {
+		s = strings.Replace(s, secret, Redacted, -1)
+	}
+
+	return s
+}
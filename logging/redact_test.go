@@ -0,0 +1,45 @@
+package logging
+
+import "testing"
+
+func TestSetSecret(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		values []string // Successive values of the secret
+		line   string
+		want   string
+	}{
+		{"set", []string{"first-secret"}, "key=first-secret", "key=" + Redacted},
+		{"unchanged", []string{"first-secret", "first-secret"}, "key=first-secret", "key=" + Redacted},
+		{"rotated", []string{"first-secret", "second-secret"}, "old=first-secret new=second-secret", "old=first-secret new=" + Redacted},
+		{"too short", []string{"abc"}, "key=abc", "key=abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			name := "test:" + tt.name
+			for _, value := range tt.values {
+				SetSecret(name, value)
+			}
+			defer SetSecret(name, "")
+
+			if got := Redact(tt.line); got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetSecretKeepsAddedSecrets(t *testing.T) {
+
+	AddSecret("added-secret")
+	SetSecret("test:added", "added-secret")
+	SetSecret("test:added", "other-secret")
+	defer SetSecret("test:added", "")
+
+	if got, want := Redact("added-secret"), Redacted; got != want {
+		t.Errorf("Redact() = %q, want %q", got, want)
+	}
+}
@@ -3,6 +3,7 @@ package main
 // v0.0.0
 import (
 	"context"
+	"errors"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,7 +14,10 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/nimbo-stratuz/bikeshare-directions/api"
+	"github.com/nimbo-stratuz/bikeshare-directions/logging"
+	"github.com/nimbo-stratuz/bikeshare-directions/metrics"
 	"github.com/nimbo-stratuz/bikeshare-directions/service"
+	"github.com/nimbo-stratuz/bikeshare-directions/tracing"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
@@ -30,7 +34,38 @@ func requestIDMiddleware(next http.Handler) http.Handler {
 			ctx = context.WithValue(ctx, middleware.RequestIDKey, uuid.New().String())
 		}
 
-		next.ServeHTTP(w, r.WithContext(ctx))
+		// Continue the caller's trace, or start a new one
+		var span *tracing.Span
+		name := "HTTP " + r.Method
+		if remote, err := tracing.ParseTraceparent(r.Header.Get(tracing.TraceparentHeader)); err == nil {
+			ctx, span = tracing.StartRemoteSpan(ctx, name, tracing.KindServer, remote)
+		} else {
+			ctx, span = tracing.StartSpan(ctx, name, tracing.KindServer)
+		}
+		defer span.End()
+
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.target", r.URL.Path)
+		span.SetAttribute("request.id", ctx.Value(middleware.RequestIDKey))
+
+		ctx = logging.WithFields(ctx, log.Fields{
+			"request_id": ctx.Value(middleware.RequestIDKey),
+			"trace_id":   span.Context().TraceIDString(),
+			"span_id":    span.Context().SpanIDString(),
+		})
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttribute("http.status_code", status)
+		if status >= 500 {
+			span.SetError(errors.New(http.StatusText(status)))
+		}
 	})
 }
 
@@ -42,7 +77,8 @@ func Routes() *chi.Mux {
 		render.SetContentType(render.ContentTypeJSON),
 
 		requestIDMiddleware,
-		middleware.Logger,
+		logging.AccessLog,
+		metrics.Middleware,
 	)
 
 	r.Mount("/", api.Routes())
@@ -52,13 +88,20 @@ func Routes() *chi.Mux {
 
 func main() {
 
+	// Subcommands, e.g. config get maps.api.key
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
+	service.Init()
+
 	if env, err := service.Config.Get("env"); err != nil || env == "prod" {
 		log.SetLevel(log.InfoLevel)
-		log.SetFormatter(&log.JSONFormatter{})
+		logging.SetFormatter(&log.JSONFormatter{})
 	}
 
 	// Make sure application quits gracefully
-	exit := make(chan os.Signal)
+	exit := make(chan os.Signal, 1)
 	signal.Notify(exit, syscall.SIGTERM)
 	signal.Notify(exit, syscall.SIGINT)
 	go func() {
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/logging"
+)
+
+var (
+	httpRequests = NewCounter(
+		"http_requests_total",
+		"Number of HTTP requests by route, method and status.",
+		"route", "method", "status",
+	)
+
+	httpDuration = NewHistogram(
+		"http_request_duration_seconds",
+		"Latency of HTTP requests by route, method and status.",
+		DefaultBuckets,
+		"route", "method", "status",
+	)
+
+	upstreamDuration = NewHistogram(
+		"upstream_request_duration_seconds",
+		"Latency of calls to upstream services (routing providers, catalogue, etcd) by outcome.",
+		DefaultBuckets,
+		"upstream", "outcome",
+	)
+
+	upstreamErrors = NewCounter(
+		"upstream_errors_total",
+		"Number of failed calls to upstream services.",
+		"upstream",
+	)
+)
+
+// Middleware counts requests and measures their latency
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := logging.Route(r.Context())
+		if route == "" {
+			route = "unmatched"
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		labels := []string{route, r.Method, strconv.Itoa(status)}
+
+		httpRequests.Inc(labels...)
+		httpDuration.ObserveSince(start, labels...)
+	})
+}
+
+// ObserveUpstream records a call to an upstream service started at start.
+// A nil err counts as a success.
+func ObserveUpstream(upstream string, start time.Time, err error) {
+
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+		upstreamErrors.Inc(upstream)
+	}
+
+	upstreamDuration.ObserveSince(start, upstream, outcome)
+}
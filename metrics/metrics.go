@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// collector is a metric family that can write itself in the
+// Prometheus text exposition format
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	registryMutex = &sync.Mutex{}
+	registry      = map[string]collector{}
+)
+
+// register adds a collector, or returns the one already registered
+// with the same name, so packages can share metrics
+func register(c collector) collector {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if existing, ok := registry[c.name()]; ok {
+		return existing
+	}
+
+	registry[c.name()] = c
+	return c
+}
+
+// Handler serves all registered metrics in the Prometheus text format
+func Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		registryMutex.Lock()
+		collectors := make([]collector, 0, len(registry))
+		for _, c := range registry {
+			collectors = append(collectors, c)
+		}
+		registryMutex.Unlock()
+
+		sort.Slice(collectors, func(i, j int) bool {
+			return collectors[i].name() < collectors[j].name()
+		})
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		for _, c := range collectors {
+			c.write(w)
+		}
+	}
+}
+
+// family holds the series of a metric, keyed by their label values
+type family struct {
+	metricName string
+	help       string
+	typ        string
+	labels     []string
+
+	mutex  *sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+
+	// Histograms only
+	buckets []uint64
+	count   uint64
+}
+
+func newFamily(name, help, typ string, labels []string) *family {
+	return &family{
+		metricName: name,
+		help:       help,
+		typ:        typ,
+		labels:     labels,
+		mutex:      &sync.Mutex{},
+		series:     make(map[string]*series),
+	}
+}
+
+func (f *family) name() string {
+	return f.metricName
+}
+
+// get returns the series for labelValues. Must be called with mutex locked.
+func (f *family) get(labelValues []string) *series {
+
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.metricName, len(f.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		f.series[key] = s
+	}
+
+	return s
+}
+
+// sorted returns all series ordered by label values. Must be called with mutex locked.
+func (f *family) sorted() []*series {
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	list := make([]*series, len(keys))
+	for i, key := range keys {
+		list[i] = f.series[key]
+	}
+
+	return list
+}
+
+func (f *family) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.metricName, strings.Replace(f.help, "\n", " ", -1))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.metricName, f.typ)
+}
+
+// formatLabels formats label pairs as {a="1",b="2"}, with extra
+// appended after the family's labels
+func formatLabels(names, values []string, extra ...string) string {
+
+	var pairs []string
+
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escape(values[i])))
+	}
+
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extra[i], escape(extra[i+1])))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Counter is a metric that can only increase
+type Counter struct {
+	*family
+}
+
+// NewCounter registers a Counter with the specified label names
+func NewCounter(name, help string, labels ...string) *Counter {
+	return register(&Counter{newFamily(name, help, "counter", labels)}).(*Counter)
+}
+
+// Inc increments the counter for the specified label values by 1
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter for the specified label values
+func (c *Counter) Add(value float64, labelValues ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.get(labelValues).value += value
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.writeHeader(w)
+	for _, s := range c.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, formatLabels(c.labels, s.labelValues), formatFloat(s.value))
+	}
+}
+
+// DefaultBuckets are histogram buckets (in seconds) suited for
+// request latencies
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Histogram counts observations in buckets
+type Histogram struct {
+	*family
+	buckets []float64
+}
+
+// NewHistogram registers a Histogram with the specified upper
+// bounds of buckets and label names
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return register(&Histogram{newFamily(name, help, "histogram", labels), buckets}).(*Histogram)
+}
+
+// Observe adds an observation for the specified label values
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	s := h.get(labelValues)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(h.buckets))
+	}
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.buckets[i]++
+		}
+	}
+
+	s.count++
+	s.value += value
+}
+
+// ObserveSince observes the time elapsed since start, in seconds
+func (h *Histogram) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.writeHeader(w)
+	for _, s := range h.sorted() {
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName,
+				formatLabels(h.labels, s.labelValues, "le", formatFloat(bound)), s.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName,
+			formatLabels(h.labels, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, formatLabels(h.labels, s.labelValues), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, formatLabels(h.labels, s.labelValues), s.count)
+	}
+}
+
+// Sample is a single value of a function metric
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// funcMetric reads its values from a function on every scrape
+type funcMetric struct {
+	*family
+	fn func() []Sample
+}
+
+// NewGaugeFunc registers a gauge whose samples are returned by fn
+func NewGaugeFunc(name, help string, labels []string, fn func() []Sample) {
+	register(&funcMetric{newFamily(name, help, "gauge", labels), fn})
+}
+
+// NewCounterFunc registers a counter whose samples are returned by fn
+func NewCounterFunc(name, help string, labels []string, fn func() []Sample) {
+	register(&funcMetric{newFamily(name, help, "counter", labels), fn})
+}
+
+func (fm *funcMetric) write(w io.Writer) {
+
+	samples := fm.fn()
+
+	sort.Slice(samples, func(i, j int) bool {
+		return fmt.Sprint(samples[i].LabelValues) < fmt.Sprint(samples[j].LabelValues)
+	})
+
+	fm.writeHeader(w)
+	for _, s := range samples {
+		fmt.Fprintf(w, "%s%s %s\n", fm.metricName, formatLabels(fm.labels, s.LabelValues), formatFloat(s.Value))
+	}
+}
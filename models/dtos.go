@@ -50,6 +50,24 @@ type DirectionsRequestOptions struct {
 	// HighwayEfficiency    int      `json:"highwayEfficiency"`
 }
 
+// LatLng is a geographic location
+type LatLng struct {
+	Lng float64 `json:"lng"`
+	Lat float64 `json:"lat"`
+}
+
+// Geocode is recieved as a response from the MapQuest Geocoding API
+// Unused fields are omitted.
+type Geocode struct {
+	Results []struct {
+		Locations []Location `json:"locations"`
+	} `json:"results"`
+	Info struct {
+		Statuscode int           `json:"statuscode"`
+		Messages   []interface{} `json:"messages"`
+	} `json:"info"`
+}
+
 // Directions is recieved as a response from the MapQuest API
 // Unused fields are commented out.
 type Directions struct {
@@ -80,72 +98,9 @@ type Directions struct {
 		// 	LocationSequence   []int   `json:"locationSequence"`
 		// 	HasSeasonalClosure bool    `json:"hasSeasonalClosure"`
 		// 	SessionID          string  `json:"sessionId"`
-		Locations []struct {
-			LatLng struct {
-				Lng float64 `json:"lng"`
-				Lat float64 `json:"lat"`
-			} `json:"latLng"`
-			AdminArea1 string `json:"adminArea1"`
-			// 		AdminArea1Type     string `json:"adminArea1Type"`
-			AdminArea3 string `json:"adminArea3"`
-			// 		AdminArea3Type     string `json:"adminArea3Type"`
-			AdminArea4 string `json:"adminArea4"`
-			// 		AdminArea4Type string `json:"adminArea4Type"`
-			AdminArea5 string `json:"adminArea5"`
-			// 		AdminArea5Type string `json:"adminArea5Type"`
-			// 		Street         string `json:"street"`
-			Type string `json:"type"`
-			// 		DisplayLatLng  struct {
-			// 			Lng float64 `json:"lng"`
-			// 			Lat float64 `json:"lat"`
-			// 		} `json:"displayLatLng"`
-			// 		LinkID             int    `json:"linkId"`
-			// 		PostalCode         string `json:"postalCode"`
-			// 		SideOfStreet       string `json:"sideOfStreet"`
-			// 		DragPoint          bool   `json:"dragPoint"`
-			// 		GeocodeQuality     string `json:"geocodeQuality"`
-			// 		GeocodeQualityCode string `json:"geocodeQualityCode"`
-		} `json:"locations"`
+		Locations []Location `json:"locations"`
 		// 	HasCountryCross bool `json:"hasCountryCross"`
-		Legs []struct {
-			// 		HasTollRoad        bool            `json:"hasTollRoad"`
-			// 		Index              int             `json:"index"`
-			// 		RoadGradeStrategy  [][]interface{} `json:"roadGradeStrategy"`
-			// 		HasHighway         bool            `json:"hasHighway"`
-			// 		HasUnpaved         bool            `json:"hasUnpaved"`
-			// 		Distance           float64         `json:"distance"`
-			// 		Time               int             `json:"time"`
-			// 		OrigIndex          int             `json:"origIndex"`
-			// 		HasSeasonalClosure bool            `json:"hasSeasonalClosure"`
-			// 		OrigNarrative      string          `json:"origNarrative"`
-			// 		HasCountryCross    bool            `json:"hasCountryCross"`
-			// 		FormattedTime      string          `json:"formattedTime"`
-			// 		DestNarrative      string          `json:"destNarrative"`
-			// 		DestIndex          int             `json:"destIndex"`
-			Maneuvers []struct {
-				// 			Signs         []interface{} `json:"signs"`
-				// 			Index         int           `json:"index"`
-				// 			ManeuverNotes []interface{} `json:"maneuverNotes"`
-				// 			Direction     int           `json:"direction"`
-				Narrative string `json:"narrative"`
-				// 			IconURL       string        `json:"iconUrl"`
-				// 			Distance      float64       `json:"distance"`
-				// 			Time          int           `json:"time"`
-				// 			LinkIds       []interface{} `json:"linkIds"`
-				// 			Streets       []string      `json:"streets"`
-				// 			Attributes    int           `json:"attributes"`
-				// 			TransportMode string        `json:"transportMode"`
-				// 			FormattedTime string        `json:"formattedTime"`
-				// 			DirectionName string        `json:"directionName"`
-				// 			MapURL        string        `json:"mapUrl,omitempty"`
-				StartPoint struct {
-					Lng float64 `json:"lng"`
-					Lat float64 `json:"lat"`
-				} `json:"startPoint"`
-				// 			TurnType int `json:"turnType"`
-			} `json:"maneuvers"`
-			// 		HasFerry bool `json:"hasFerry"`
-		} `json:"legs"`
+		Legs []Leg `json:"legs"`
 		// 	FormattedTime string `json:"formattedTime"`
 		// 	RouteError    struct {
 		// 		Message   string `json:"message"`
@@ -186,7 +141,8 @@ type Directions struct {
 		// 	} `json:"options"`
 		// 	HasFerry bool `json:"hasFerry"`
 	} `json:"route"`
-	Info struct {
+	Provider string `json:"provider,omitempty"` // Routing provider that computed the route
+	Info     struct {
 		Copyright struct {
 			Text         string `json:"text"`
 			ImageURL     string `json:"imageUrl"`
@@ -197,6 +153,72 @@ type Directions struct {
 	} `json:"info"`
 }
 
+// Location is a geocoded location of a Directions or Geocode response
+// Unused fields are commented out.
+type Location struct {
+	LatLng     LatLng `json:"latLng"`
+	AdminArea1 string `json:"adminArea1"`
+	// AdminArea1Type     string `json:"adminArea1Type"`
+	AdminArea3 string `json:"adminArea3"`
+	// AdminArea3Type     string `json:"adminArea3Type"`
+	AdminArea4 string `json:"adminArea4"`
+	// AdminArea4Type string `json:"adminArea4Type"`
+	AdminArea5 string `json:"adminArea5"`
+	// AdminArea5Type string `json:"adminArea5Type"`
+	Street string `json:"street,omitempty"`
+	Type   string `json:"type"`
+	// DisplayLatLng  LatLng `json:"displayLatLng"`
+	// LinkID             int    `json:"linkId"`
+	// PostalCode         string `json:"postalCode"`
+	// SideOfStreet       string `json:"sideOfStreet"`
+	// DragPoint          bool   `json:"dragPoint"`
+	GeocodeQuality     string `json:"geocodeQuality,omitempty"`
+	GeocodeQualityCode string `json:"geocodeQualityCode,omitempty"`
+}
+
+// Leg is a part of a Directions route
+// Unused fields are commented out.
+type Leg struct {
+	// HasTollRoad        bool            `json:"hasTollRoad"`
+	// Index              int             `json:"index"`
+	// RoadGradeStrategy  [][]interface{} `json:"roadGradeStrategy"`
+	// HasHighway         bool            `json:"hasHighway"`
+	// HasUnpaved         bool            `json:"hasUnpaved"`
+	// Distance           float64         `json:"distance"`
+	// Time               int             `json:"time"`
+	// OrigIndex          int             `json:"origIndex"`
+	// HasSeasonalClosure bool            `json:"hasSeasonalClosure"`
+	// OrigNarrative      string          `json:"origNarrative"`
+	// HasCountryCross    bool            `json:"hasCountryCross"`
+	// FormattedTime      string          `json:"formattedTime"`
+	// DestNarrative      string          `json:"destNarrative"`
+	// DestIndex          int             `json:"destIndex"`
+	Maneuvers []Maneuver `json:"maneuvers"`
+	// HasFerry bool `json:"hasFerry"`
+}
+
+// Maneuver is a single step of a Leg
+// Unused fields are commented out.
+type Maneuver struct {
+	// Signs         []interface{} `json:"signs"`
+	// Index         int           `json:"index"`
+	// ManeuverNotes []interface{} `json:"maneuverNotes"`
+	// Direction     int           `json:"direction"`
+	Narrative string `json:"narrative"`
+	// IconURL       string        `json:"iconUrl"`
+	// Distance      float64       `json:"distance"`
+	// Time          int           `json:"time"`
+	// LinkIds       []interface{} `json:"linkIds"`
+	// Streets       []string      `json:"streets"`
+	// Attributes    int           `json:"attributes"`
+	// TransportMode string        `json:"transportMode"`
+	// FormattedTime string        `json:"formattedTime"`
+	// DirectionName string        `json:"directionName"`
+	// MapURL        string        `json:"mapUrl,omitempty"`
+	StartPoint LatLng `json:"startPoint"`
+	// TurnType int `json:"turnType"`
+}
+
 // Render ...
 func (dirs *Directions) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
@@ -219,12 +241,68 @@ func (b *Bicycle) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// LocationCandidate is a possible match for an ambiguous location
+type LocationCandidate struct {
+	Label          string `json:"label"`
+	LatLng         LatLng `json:"latLng"`
+	GeocodeQuality string `json:"geocodeQuality,omitempty"`
+}
+
+// DirectionsWithBicycle is the response of /v1/directions.
+// If there is no bicycle available, Bicycle is null and
+// BicycleUnavailable explains why.
 type DirectionsWithBicycle struct {
-	Bicycle    *Bicycle    `json:"bicycle"`
-	Directions *Directions `json:"directions"`
+	Bicycle            *Bicycle            `json:"bicycle"`
+	BicycleUnavailable *BicycleUnavailable `json:"bicycleUnavailable,omitempty"`
+	Directions         *Directions         `json:"directions"`
+}
+
+// BicycleUnavailable explains why no bicycle was found
+type BicycleUnavailable struct {
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
 }
 
 // Render ...
 func (dwb *DirectionsWithBicycle) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
+
+// ConfigEntry is the effective value of a config key
+type ConfigEntry struct {
+	Key      string `json:"key"`
+	Value    string `json:"value,omitempty"`  // Secrets are redacted
+	Source   string `json:"source,omitempty"` // env, secrets, etcd, yaml or default; empty if not set
+	Writable bool   `json:"writable"`         // Can be set with PUT /admin/config/{key}
+}
+
+// Render ...
+func (ce *ConfigEntry) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// ConfigEntries is the response of GET /admin/config
+type ConfigEntries struct {
+	Entries []*ConfigEntry `json:"entries"`
+}
+
+// Render ...
+func (ces *ConfigEntries) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// ConfigValue is the request of PUT /admin/config/{key}. Example:
+// {
+// 	 "value": "graphhopper,mapquest"
+// }
+type ConfigValue struct {
+	Value *string `json:"value"`
+}
+
+// Bind ensures the value is set in a ConfigValue
+func (cv *ConfigValue) Bind(r *http.Request) error {
+	if cv.Value == nil {
+		return errors.New("Missing 'value' field")
+	}
+	return nil
+}
@@ -3,17 +3,31 @@ package models
 import (
 	"net/http"
 
+	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/render"
 )
 
-// ErrResponse is used to display errors as API responses
-type ErrResponse struct {
-	StatusCode int    `json:"status"`            // user-level status message
-	ErrorText  string `json:"message,omitempty"` // application-level error message, for debugging
+// Problem is used to display errors as API responses,
+// following RFC 7807 (application/problem+json)
+type Problem struct {
+	Type      string `json:"type"`                // URI identifying the problem type
+	Title     string `json:"title"`               // short, human-readable summary of the problem type
+	Status    int    `json:"status"`              // HTTP status code
+	Code      string `json:"code"`                // stable, machine-readable error code
+	Detail    string `json:"detail,omitempty"`    // explanation specific to this occurrence, for debugging
+	Instance  string `json:"instance,omitempty"`  // request path
+	RequestID string `json:"requestId,omitempty"` // X-Request-ID of the request
+
+	Candidates []LocationCandidate `json:"candidates,omitempty"` // possible matches for an ambiguous location
 }
 
-// Render sets HTTP Status code from the ErrResponse struct
-func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
-	render.Status(r, e.StatusCode)
+// Render sets HTTP Status code from the Problem struct
+// and fills in the request specific fields
+func (p *Problem) Render(w http.ResponseWriter, r *http.Request) error {
+	render.Status(r, p.Status)
+
+	p.Instance = r.URL.Path
+	p.RequestID = middleware.GetReqID(r.Context())
+
 	return nil
 }
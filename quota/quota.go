@@ -0,0 +1,331 @@
+package quota
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/config"
+	"github.com/nimbo-stratuz/bikeshare-directions/metrics"
+)
+
+// Budget limits the number of upstream transactions of a provider.
+// Zero means unlimited.
+type Budget struct {
+	DailySoft   int
+	DailyHard   int
+	MonthlySoft int
+	MonthlyHard int
+}
+
+// Level tells how much of its Budget a provider has used
+type Level int
+
+const (
+	// Within the budget
+	Within Level = iota
+	// SoftExceeded means a soft limit is exceeded, the provider should
+	// only be used through cached results or failover
+	SoftExceeded
+	// HardExceeded means a hard limit is exceeded, no more calls are allowed
+	HardExceeded
+)
+
+// Accountant counts upstream transactions per provider per day and month.
+// Counters are kept in memory and periodically added to the counters
+// persisted in store, which are shared between instances. The store is
+// only called by the flush loop, never while checking a budget.
+type Accountant struct {
+	store   config.Counter // nil keeps counters in memory only
+	budgets map[string]Budget
+
+	flushMutex *sync.Mutex // Serializes flushes
+	mutex      *sync.Mutex
+	counters   map[string]*counter // Keyed by storage key
+	warned     map[string]bool     // Soft limits already logged, keyed by storage key
+
+	quit chan bool
+	done chan bool
+}
+
+type counter struct {
+	provider  string
+	persisted int // Last known value in store, 0 until the first flush
+	flushing  int // Being added to store
+	pending   int // Not yet added to store
+}
+
+func (c *counter) count() int {
+	return c.persisted + c.flushing + c.pending
+}
+
+// New creates an Accountant, which reads the counters of budgeted
+// providers from store in the background, then flushes counters to
+// store every flushInterval until it is closed
+func New(store config.Counter, budgets map[string]Budget, flushInterval time.Duration) *Accountant {
+
+	a := &Accountant{
+		store:      store,
+		budgets:    budgets,
+		flushMutex: &sync.Mutex{},
+		mutex:      &sync.Mutex{},
+		counters:   make(map[string]*counter),
+		warned:     make(map[string]bool),
+		quit:       make(chan bool),
+		done:       make(chan bool),
+	}
+
+	publish(a)
+
+	go func() {
+		defer close(a.done)
+
+		a.flush()
+
+		for {
+			select {
+			case <-a.quit:
+				a.flush()
+				return
+			case <-time.After(flushInterval):
+				a.flush()
+			}
+		}
+	}()
+
+	return a
+}
+
+// Close flushes all counters and stops flushing
+func (a *Accountant) Close() error {
+
+	log.Info("Closing quota Accountant")
+
+	close(a.quit)
+	<-a.done
+
+	return nil
+}
+
+// Record counts a single transaction with the provider
+func (a *Accountant) Record(provider string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := time.Now().UTC()
+
+	for _, key := range []string{dailyKey(provider, now), monthlyKey(provider, now)} {
+		a.counter(provider, key).pending++
+	}
+}
+
+// Usage returns the number of transactions with the provider today
+// and in the current month, as of the last flush
+func (a *Accountant) Usage(provider string) (daily, monthly int) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := time.Now().UTC()
+
+	return a.counter(provider, dailyKey(provider, now)).count(), a.counter(provider, monthlyKey(provider, now)).count()
+}
+
+// Check compares the usage of the provider with its Budget.
+// Exceeded soft limits are logged once per period.
+func (a *Accountant) Check(provider string) Level {
+
+	budget, ok := a.budgets[provider]
+	if !ok {
+		return Within
+	}
+
+	daily, monthly := a.Usage(provider)
+
+	if exceeds(daily, budget.DailyHard) || exceeds(monthly, budget.MonthlyHard) {
+		a.warnOnce(provider, "hard", daily, monthly)
+		return HardExceeded
+	}
+
+	if exceeds(daily, budget.DailySoft) || exceeds(monthly, budget.MonthlySoft) {
+		a.warnOnce(provider, "soft", daily, monthly)
+		return SoftExceeded
+	}
+
+	return Within
+}
+
+func exceeds(usage, limit int) bool {
+	return limit > 0 && usage >= limit
+}
+
+func (a *Accountant) warnOnce(provider, limit string, daily, monthly int) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	key := fmt.Sprintf("%s/%s", dailyKey(provider, time.Now().UTC()), limit)
+	if a.warned[key] {
+		return
+	}
+	a.warned[key] = true
+
+	log.Warnf("Quota: %s limit of provider %s exceeded (today: %d, this month: %d)",
+		limit, provider, daily, monthly)
+}
+
+// counter returns the counter for key, creating it if needed.
+// Must be called with mutex locked.
+func (a *Accountant) counter(provider, key string) *counter {
+
+	if c, ok := a.counters[key]; ok {
+		return c
+	}
+
+	c := &counter{provider: provider}
+	a.counters[key] = c
+
+	return c
+}
+
+// flush adds pending counts to the counters in store, and reads the
+// counts of other instances, including those of budgeted providers not
+// called by this instance yet. Counters from past periods are dropped
+// once flushed. store is called without holding mutex, so transactions
+// recorded meanwhile stay pending for the next flush. If store fails,
+// counts are local until the next flush.
+func (a *Accountant) flush() {
+	a.flushMutex.Lock()
+	defer a.flushMutex.Unlock()
+
+	now := time.Now().UTC()
+
+	a.mutex.Lock()
+	for provider := range a.budgets {
+		a.counter(provider, dailyKey(provider, now))
+		a.counter(provider, monthlyKey(provider, now))
+	}
+
+	flushing := make(map[string]int, len(a.counters))
+	for key, c := range a.counters {
+
+		current := key == dailyKey(c.provider, now) || key == monthlyKey(c.provider, now)
+
+		if a.store == nil {
+			c.persisted += c.pending
+			c.pending = 0
+		} else if c.pending > 0 || current {
+			c.flushing, c.pending = c.pending, 0
+			flushing[key] = c.flushing
+			continue
+		}
+
+		if !current {
+			delete(a.counters, key)
+		}
+	}
+	a.mutex.Unlock()
+
+	for key, delta := range flushing {
+
+		var persisted int
+		var err error
+		if delta > 0 {
+			persisted, err = a.store.Add(key, delta)
+		} else {
+			persisted, err = a.store.Count(key)
+		}
+		if err != nil {
+			log.Warnf("Quota: cannot persist %s: %s", key, err)
+		}
+
+		a.mutex.Lock()
+		c := a.counters[key]
+		if err != nil {
+			// Retry with the next flush
+			c.pending += c.flushing
+		} else {
+			c.persisted = persisted
+		}
+		c.flushing = 0
+
+		if key != dailyKey(c.provider, now) && key != monthlyKey(c.provider, now) && c.pending == 0 {
+			delete(a.counters, key)
+		}
+		a.mutex.Unlock()
+	}
+}
+
+var (
+	publishedMutex = &sync.Mutex{}
+	published      *Accountant // Last created Accountant, whose usage is published
+)
+
+// publish exposes the usage of a as expvar "quota" and as metrics. Both
+// can only be registered once, so they read the last created Accountant.
+func publish(a *Accountant) {
+	publishedMutex.Lock()
+	defer publishedMutex.Unlock()
+
+	if published == nil {
+		expvar.Publish("quota", expvar.Func(func() interface{} {
+			return current().stats()
+		}))
+		metrics.NewGaugeFunc(
+			"quota_transactions",
+			"Number of transactions with routing providers in the current day and month.",
+			[]string{"provider", "period"},
+			func() []metrics.Sample { return current().samples() },
+		)
+	}
+
+	published = a
+}
+
+func current() *Accountant {
+	publishedMutex.Lock()
+	defer publishedMutex.Unlock()
+	return published
+}
+
+func (a *Accountant) stats() interface{} {
+
+	usage := map[string]interface{}{}
+
+	for provider, budget := range a.budgets {
+		daily, monthly := a.Usage(provider)
+
+		usage[provider] = map[string]interface{}{
+			"daily":   daily,
+			"monthly": monthly,
+			"budget":  budget,
+		}
+	}
+
+	return usage
+}
+
+func (a *Accountant) samples() []metrics.Sample {
+
+	var samples []metrics.Sample
+
+	for provider := range a.budgets {
+		daily, monthly := a.Usage(provider)
+
+		samples = append(samples,
+			metrics.Sample{LabelValues: []string{provider, "daily"}, Value: float64(daily)},
+			metrics.Sample{LabelValues: []string{provider, "monthly"}, Value: float64(monthly)},
+		)
+	}
+
+	return samples
+}
+
+func dailyKey(provider string, t time.Time) string {
+	return fmt.Sprintf("quota/%s/%s", provider, t.Format("2006-01-02"))
+}
+
+func monthlyKey(provider string, t time.Time) string {
+	return fmt.Sprintf("quota/%s/%s", provider, t.Format("2006-01"))
+}
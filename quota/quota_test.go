@@ -0,0 +1,295 @@
+package quota
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCounter is a config.Counter in memory. Calls block while block
+// is set and fail while err is set.
+type fakeCounter struct {
+	mutex  *sync.Mutex
+	values map[string]int
+	err    error
+	block  chan struct{}
+}
+
+func newFakeCounter() *fakeCounter {
+	return &fakeCounter{mutex: &sync.Mutex{}, values: make(map[string]int)}
+}
+
+func (fc *fakeCounter) Count(key string) (int, error) {
+
+	fc.wait()
+
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	if fc.err != nil {
+		return 0, fc.err
+	}
+
+	return fc.values[key], nil
+}
+
+func (fc *fakeCounter) Add(key string, delta int) (int, error) {
+
+	fc.wait()
+
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	if fc.err != nil {
+		return 0, fc.err
+	}
+
+	fc.values[key] += delta
+
+	return fc.values[key], nil
+}
+
+// wait blocks while block is set
+func (fc *fakeCounter) wait() {
+
+	fc.mutex.Lock()
+	block := fc.block
+	fc.mutex.Unlock()
+
+	if block != nil {
+		<-block
+	}
+}
+
+func (fc *fakeCounter) set(key string, value int) {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	fc.values[key] = value
+}
+
+func (fc *fakeCounter) get(key string) int {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	return fc.values[key]
+}
+
+func (fc *fakeCounter) fail(err error) {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	fc.err = err
+}
+
+func (fc *fakeCounter) blockCalls(block chan struct{}) {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	fc.block = block
+}
+
+// newAccountant creates an Accountant that is only flushed explicitly
+func newAccountant(store *fakeCounter, budgets map[string]Budget) *Accountant {
+	if store == nil {
+		return New(nil, budgets, time.Hour)
+	}
+	return New(store, budgets, time.Hour)
+}
+
+func TestCheck(t *testing.T) {
+
+	budget := Budget{DailySoft: 2, DailyHard: 4, MonthlySoft: 3, MonthlyHard: 10}
+
+	tests := []struct {
+		records int
+		want    Level
+	}{
+		{0, Within},
+		{1, Within},
+		{2, SoftExceeded},
+		{3, SoftExceeded},
+		{4, HardExceeded},
+		{5, HardExceeded},
+	}
+
+	for _, test := range tests {
+		a := newAccountant(nil, map[string]Budget{"mapquest": budget})
+
+		for i := 0; i < test.records; i++ {
+			a.Record("mapquest")
+		}
+
+		if level := a.Check("mapquest"); level != test.want {
+			t.Errorf("%d records: Check() = %d, want %d", test.records, level, test.want)
+		}
+		if level := a.Check("graphhopper"); level != Within {
+			t.Errorf("provider without budget: Check() = %d, want Within", level)
+		}
+
+		a.Close()
+	}
+}
+
+func TestFlushSharesCounters(t *testing.T) {
+
+	store := newFakeCounter()
+	now := time.Now().UTC()
+
+	// Usage of earlier instances
+	store.set(dailyKey("mapquest", now), 10)
+	store.set(monthlyKey("mapquest", now), 100)
+
+	first := newAccountant(store, nil)
+	second := newAccountant(store, nil)
+	defer second.Close()
+
+	first.Record("mapquest")
+	first.Record("mapquest")
+	second.Record("mapquest")
+
+	// Counts of earlier instances are read by flushes
+	first.flush()
+	if daily, monthly := first.Usage("mapquest"); daily != 12 || monthly != 102 {
+		t.Errorf("Usage() = %d, %d, want 12, 102", daily, monthly)
+	}
+
+	second.flush()
+
+	if value := store.get(dailyKey("mapquest", now)); value != 13 {
+		t.Errorf("stored daily counter = %d, want 13", value)
+	}
+
+	// Counts of other instances are read with the next flush
+	first.flush()
+	if daily, monthly := first.Usage("mapquest"); daily != 13 || monthly != 103 {
+		t.Errorf("Usage() after flush = %d, %d, want 13, 103", daily, monthly)
+	}
+
+	// Close flushes
+	first.Record("mapquest")
+	first.Close()
+	if value := store.get(monthlyKey("mapquest", now)); value != 104 {
+		t.Errorf("stored monthly counter after Close = %d, want 104", value)
+	}
+}
+
+func TestFlushError(t *testing.T) {
+
+	store := newFakeCounter()
+	now := time.Now().UTC()
+
+	a := newAccountant(store, nil)
+	defer a.Close()
+
+	a.Record("mapquest")
+	a.Usage("mapquest")
+
+	store.fail(errors.New("etcd is down"))
+	a.flush()
+
+	// Pending transactions are kept and counted
+	if daily, _ := a.Usage("mapquest"); daily != 1 {
+		t.Errorf("Usage() after a failed flush = %d, want 1", daily)
+	}
+
+	store.fail(nil)
+	a.flush()
+
+	if value := store.get(dailyKey("mapquest", now)); value != 1 {
+		t.Errorf("stored daily counter = %d, want 1", value)
+	}
+	if daily, _ := a.Usage("mapquest"); daily != 1 {
+		t.Errorf("Usage() after a retried flush = %d, want 1", daily)
+	}
+}
+
+func TestFlushDoesNotBlockRequests(t *testing.T) {
+
+	store := newFakeCounter()
+
+	a := newAccountant(store, map[string]Budget{"mapquest": {DailyHard: 100}})
+	defer a.Close()
+
+	a.Record("mapquest")
+	a.Usage("mapquest")
+
+	block := make(chan struct{})
+	store.blockCalls(block)
+
+	flushed := make(chan struct{})
+	go func() {
+		a.flush()
+		close(flushed)
+	}()
+
+	// Requests are counted and checked while the store is slow
+	checked := make(chan Level)
+	go func() {
+		a.Record("mapquest")
+		checked <- a.Check("mapquest")
+	}()
+
+	select {
+	case <-checked:
+	case <-time.After(time.Second):
+		t.Fatal("Check blocked while flushing")
+	}
+
+	close(block)
+	<-flushed
+
+	if daily, _ := a.Usage("mapquest"); daily != 2 {
+		t.Errorf("Usage() = %d, want 2", daily)
+	}
+}
+
+func TestCheckDoesNotCallStore(t *testing.T) {
+
+	store := newFakeCounter()
+	store.set(dailyKey("mapquest", time.Now().UTC()), 5)
+
+	// etcd is slow or down
+	block := make(chan struct{})
+	store.blockCalls(block)
+
+	a := newAccountant(store, map[string]Budget{"mapquest": {DailyHard: 5}})
+
+	checked := make(chan Level)
+	go func() {
+		a.Record("mapquest")
+		checked <- a.Check("mapquest")
+	}()
+
+	// Counts are local until the store can be read
+	select {
+	case level := <-checked:
+		if level != Within {
+			t.Errorf("Check() before the first flush = %d, want Within", level)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Check blocked on the store")
+	}
+
+	close(block)
+	a.flush()
+
+	if level := a.Check("mapquest"); level != HardExceeded {
+		t.Errorf("Check() after a flush = %d, want HardExceeded", level)
+	}
+
+	a.Close()
+}
+
+func TestFlushLoadsBudgetedProviders(t *testing.T) {
+
+	store := newFakeCounter()
+	store.set(monthlyKey("graphhopper", time.Now().UTC()), 7)
+
+	a := newAccountant(store, map[string]Budget{"graphhopper": {MonthlySoft: 5}})
+	defer a.Close()
+
+	// Not called by this instance yet
+	a.flush()
+
+	if level := a.Check("graphhopper"); level != SoftExceeded {
+		t.Errorf("Check() = %d, want SoftExceeded", level)
+	}
+}
@@ -0,0 +1,103 @@
+package routing
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/cache"
+	"github.com/nimbo-stratuz/bikeshare-directions/logging"
+	"github.com/nimbo-stratuz/bikeshare-directions/models"
+)
+
+// cached is a Provider that stores routes and geocoded
+// locations in a cache.Cache
+type cached struct {
+	provider Provider
+	cache    cache.Cache
+	ttl      time.Duration
+}
+
+// NewCached creates a Provider that returns cached results when possible
+// and caches results computed by provider for ttl
+func NewCached(provider Provider, c cache.Cache, ttl time.Duration) Provider {
+	return &cached{
+		provider: provider,
+		cache:    c,
+		ttl:      ttl,
+	}
+}
+
+func (c *cached) Name() string {
+	return c.provider.Name()
+}
+
+func (c *cached) Route(ctx context.Context, from, to string) (*models.Directions, error) {
+
+	key := routeKey(from, to)
+
+	route := &models.Directions{}
+	if err := cache.GetJSON(c.cache, key, route); err == nil {
+		logging.FromContext(ctx).Debugf("Route %s found in cache", key)
+		return route, nil
+	}
+
+	route, err := c.provider.Route(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cache.SetJSON(c.cache, key, route, c.ttl); err != nil {
+		logging.FromContext(ctx).Warn("Cannot cache route: ", err)
+	}
+
+	return route, nil
+}
+
+func (c *cached) Geocode(ctx context.Context, location string) (*models.LatLng, error) {
+
+	key := geocodeKey(location)
+
+	latLng := &models.LatLng{}
+	if err := cache.GetJSON(c.cache, key, latLng); err == nil {
+		logging.FromContext(ctx).Debugf("Location %s found in cache", key)
+		return latLng, nil
+	}
+
+	latLng, err := c.provider.Geocode(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cache.SetJSON(c.cache, key, latLng, c.ttl); err != nil {
+		logging.FromContext(ctx).Warn("Cannot cache location: ", err)
+	}
+
+	return latLng, nil
+}
+
+// routeKey identifies a route between two locations, regardless of
+// letter case and surrounding whitespace
+func routeKey(from, to string) string {
+	return "route:" + hashLocations(from, to)
+}
+
+// geocodeKey identifies a location, regardless of letter case
+// and surrounding whitespace
+func geocodeKey(location string) string {
+	return "geocode:" + hashLocations(location)
+}
+
+func hashLocations(locations ...string) string {
+
+	normalized := make([]string, len(locations))
+	for i, location := range locations {
+		normalized[i] = strings.ToLower(strings.TrimSpace(location))
+	}
+
+	hash := sha1.Sum([]byte(strings.Join(normalized, "\x00")))
+
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,52 @@
+package routing
+
+import (
+	"context"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/coalesce"
+	"github.com/nimbo-stratuz/bikeshare-directions/models"
+)
+
+// coalescing is a Provider that shares a single upstream request
+// between identical concurrent calls
+type coalescing struct {
+	provider Provider
+	group    *coalesce.Group
+}
+
+// NewCoalescing creates a Provider that coalesces identical concurrent
+// calls to provider
+func NewCoalescing(provider Provider) Provider {
+	return &coalescing{
+		provider: provider,
+		group:    coalesce.NewGroup("routing." + provider.Name()),
+	}
+}
+
+func (c *coalescing) Name() string {
+	return c.provider.Name()
+}
+
+func (c *coalescing) Route(ctx context.Context, from, to string) (*models.Directions, error) {
+
+	value, err, _ := c.group.Do(ctx, routeKey(from, to), func(ctx context.Context) (interface{}, error) {
+		return c.provider.Route(ctx, from, to)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.(*models.Directions), nil
+}
+
+func (c *coalescing) Geocode(ctx context.Context, location string) (*models.LatLng, error) {
+
+	value, err, _ := c.group.Do(ctx, geocodeKey(location), func(ctx context.Context) (interface{}, error) {
+		return c.provider.Geocode(ctx, location)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.(*models.LatLng), nil
+}
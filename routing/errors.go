@@ -0,0 +1,91 @@
+package routing
+
+import (
+	"fmt"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/models"
+)
+
+// UnavailableError is returned when a routing provider cannot be reached
+// or its response cannot be read
+type UnavailableError struct {
+	provider string
+	reason   string
+}
+
+// NewUnavailableError creates a new UnavailableError
+func NewUnavailableError(provider, reason string) *UnavailableError {
+	return &UnavailableError{provider, reason}
+}
+
+func (ue *UnavailableError) Error() string {
+	return fmt.Sprintf("Routing provider %s unavailable: %s", ue.provider, ue.reason)
+}
+
+// StatusError is returned when a routing provider responds
+// with a non-zero status code
+type StatusError struct {
+	provider   string
+	Statuscode int
+}
+
+// NewStatusError creates a new StatusError
+func NewStatusError(provider string, statuscode int) *StatusError {
+	return &StatusError{provider, statuscode}
+}
+
+func (se *StatusError) Error() string {
+	return fmt.Sprintf("Routing provider %s error: status code %d", se.provider, se.Statuscode)
+}
+
+// NotFoundError is returned when a routing provider
+// cannot resolve a location
+type NotFoundError struct {
+	provider string
+	location string
+}
+
+// NewNotFoundError creates a new NotFoundError
+func NewNotFoundError(provider, location string) *NotFoundError {
+	return &NotFoundError{provider, location}
+}
+
+func (nfe *NotFoundError) Error() string {
+	return fmt.Sprintf("Routing provider %s cannot resolve location '%s'", nfe.provider, nfe.location)
+}
+
+// QuotaExceededError is returned when a soft or hard budget of
+// a routing provider is exceeded
+type QuotaExceededError struct {
+	provider string
+	limit    string // "soft" or "hard"
+}
+
+// NewQuotaExceededError creates a new QuotaExceededError for the
+// exceeded limit ("soft" or "hard")
+func NewQuotaExceededError(provider, limit string) *QuotaExceededError {
+	return &QuotaExceededError{provider, limit}
+}
+
+func (qee *QuotaExceededError) Error() string {
+	return fmt.Sprintf("Routing provider %s %s quota exceeded", qee.provider, qee.limit)
+}
+
+// AmbiguousLocationError is returned when a location can only be
+// resolved too coarsely (e.g. to a city centroid) to compute a route
+type AmbiguousLocationError struct {
+	provider   string
+	location   string
+	Candidates []models.LocationCandidate
+
+	lookups int // Transactions made to find the candidates
+}
+
+// NewAmbiguousLocationError creates a new AmbiguousLocationError
+func NewAmbiguousLocationError(provider, location string, candidates []models.LocationCandidate) *AmbiguousLocationError {
+	return &AmbiguousLocationError{provider: provider, location: location, Candidates: candidates}
+}
+
+func (ale *AmbiguousLocationError) Error() string {
+	return fmt.Sprintf("Routing provider %s cannot resolve location '%s' precisely", ale.provider, ale.location)
+}
@@ -0,0 +1,111 @@
+package routing
+
+import (
+	"context"
+	"time"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/logging"
+	"github.com/nimbo-stratuz/bikeshare-directions/models"
+)
+
+// failover is a Provider that tries multiple providers in priority order
+type failover struct {
+	providers []Provider
+}
+
+// NewFailover creates a Provider that calls providers in the specified
+// order, until one of them succeeds. A provider fails if it cannot be
+// reached in time, its circuit breaker is open or it returns an error.
+// Each provider gets a share of the time remaining in the context.
+func NewFailover(providers ...Provider) Provider {
+
+	if len(providers) == 1 {
+		return providers[0]
+	}
+
+	return &failover{providers: providers}
+}
+
+func (f *failover) Name() string {
+	return "failover"
+}
+
+func (f *failover) Route(ctx context.Context, from, to string) (*models.Directions, error) {
+
+	var lastErr error
+
+	for i, provider := range f.providers {
+
+		attemptCtx, cancel := f.attempt(ctx, i)
+		route, err := provider.Route(attemptCtx, from, to)
+		cancel()
+		if err == nil {
+			return route, nil
+		}
+
+		lastErr = err
+		if !failOver(ctx, err) {
+			break
+		}
+
+		logging.FromContext(ctx).
+			WithField("provider", provider.Name()).
+			Warn("Routing provider failed, failing over: ", err)
+	}
+
+	return nil, lastErr
+}
+
+func (f *failover) Geocode(ctx context.Context, location string) (*models.LatLng, error) {
+
+	var lastErr error
+
+	for i, provider := range f.providers {
+
+		attemptCtx, cancel := f.attempt(ctx, i)
+		latLng, err := provider.Geocode(attemptCtx, location)
+		cancel()
+		if err == nil {
+			return latLng, nil
+		}
+
+		lastErr = err
+		if !failOver(ctx, err) {
+			break
+		}
+
+		logging.FromContext(ctx).
+			WithField("provider", provider.Name()).
+			Warn("Routing provider failed, failing over: ", err)
+	}
+
+	return nil, lastErr
+}
+
+// attempt returns the context of the call to the i-th provider, with an
+// even share of the time remaining in ctx, so that a provider that hangs
+// leaves time for the next ones. The last provider gets all of it.
+func (f *failover) attempt(ctx context.Context, i int) (context.Context, context.CancelFunc) {
+
+	deadline, ok := ctx.Deadline()
+	remaining := len(f.providers) - i
+	if !ok || remaining <= 1 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, time.Until(deadline)/time.Duration(remaining))
+}
+
+// failOver reports whether the next provider should be tried after err,
+// unless the whole request timed out or was canceled. Ambiguous
+// locations are ambiguous for every provider.
+func failOver(ctx context.Context, err error) bool {
+
+	if ctx.Err() != nil {
+		return false
+	}
+
+	_, ambiguous := err.(*AmbiguousLocationError)
+
+	return !ambiguous
+}
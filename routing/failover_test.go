@@ -0,0 +1,80 @@
+package routing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/models"
+)
+
+// hangingProvider blocks until the context of the call is done
+type hangingProvider struct{}
+
+func (hp *hangingProvider) Name() string {
+	return "hanging"
+}
+
+func (hp *hangingProvider) Route(ctx context.Context, from, to string) (*models.Directions, error) {
+	<-ctx.Done()
+	return nil, NewUnavailableError(hp.Name(), ctx.Err().Error())
+}
+
+func (hp *hangingProvider) Geocode(ctx context.Context, location string) (*models.LatLng, error) {
+	<-ctx.Done()
+	return nil, NewUnavailableError(hp.Name(), ctx.Err().Error())
+}
+
+func TestFailoverAfterHangingProvider(t *testing.T) {
+
+	provider := NewFailover(&hangingProvider{}, &fakeProvider{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	if _, err := provider.Route(ctx, "from", "to"); err != nil {
+		t.Errorf("Route: %v", err)
+	}
+	if _, err := provider.Geocode(ctx, "from"); err != nil {
+		t.Errorf("Geocode: %v", err)
+	}
+
+	if ctx.Err() != nil {
+		t.Errorf("fallback called after %s, want within the budget", time.Since(start))
+	}
+}
+
+func TestFailover(t *testing.T) {
+
+	tests := []struct {
+		first error
+		fails bool
+	}{
+		{nil, false},
+		{NewUnavailableError("first", "connection refused"), false},
+		{NewStatusError("first", 403), false},
+		{NewQuotaExceededError("first", "soft"), false},
+		// Ambiguous for every provider
+		{NewAmbiguousLocationError("first", "Ljubljana", nil), true},
+	}
+
+	for _, test := range tests {
+		provider := NewFailover(&fakeProvider{err: test.first}, &fakeProvider{})
+
+		_, err := provider.Route(context.Background(), "from", "to")
+		if (err != nil) != test.fails {
+			t.Errorf("first provider failing with %v: Route error = %v", test.first, err)
+		}
+	}
+
+	// The whole request timed out
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	provider := NewFailover(&hangingProvider{}, &fakeProvider{})
+	if _, err := provider.Route(ctx, "from", "to"); err == nil {
+		t.Error("Route after the request was canceled succeeded")
+	}
+}
@@ -0,0 +1,176 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/models"
+	"github.com/nimbo-stratuz/bikeshare-directions/upstream"
+)
+
+// graphHopper is a Provider using the GraphHopper Routing and Geocoding APIs
+type graphHopper struct {
+	apiKey string
+	client *upstream.Client
+}
+
+const (
+	graphHopperRouteURL   = "https://graphhopper.com/api/1/route"
+	graphHopperGeocodeURL = "https://graphhopper.com/api/1/geocode"
+)
+
+// graphHopperRoute is recieved as a response from the GraphHopper Routing API
+// Unused fields are omitted.
+type graphHopperRoute struct {
+	Paths []struct {
+		Distance float64 `json:"distance"` // meters
+		Points   struct {
+			Coordinates [][]float64 `json:"coordinates"` // [lng, lat]
+		} `json:"points"`
+		Instructions []struct {
+			Text     string `json:"text"`
+			Interval []int  `json:"interval"` // Indexes into Points.Coordinates
+		} `json:"instructions"`
+	} `json:"paths"`
+	Info struct {
+		Copyrights []string `json:"copyrights"`
+	} `json:"info"`
+	Message string `json:"message"` // Set on errors
+}
+
+// graphHopperGeocode is recieved as a response from the GraphHopper Geocoding API
+// Unused fields are omitted.
+type graphHopperGeocode struct {
+	Hits []struct {
+		Point models.LatLng `json:"point"`
+	} `json:"hits"`
+	Message string `json:"message"` // Set on errors
+}
+
+// NewGraphHopper creates a Provider using the GraphHopper APIs
+func NewGraphHopper(apiKey string, client *upstream.Client) Provider {
+	return &graphHopper{
+		apiKey: apiKey,
+		client: client,
+	}
+}
+
+func (gh *graphHopper) Name() string {
+	return "graphhopper"
+}
+
+func (gh *graphHopper) Route(ctx context.Context, from, to string) (*models.Directions, error) {
+
+	// GraphHopper only routes between coordinates
+	fromLatLng, err := gh.resolve(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+
+	toLatLng, err := gh.resolve(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Add("point", fmt.Sprintf("%f,%f", fromLatLng.Lat, fromLatLng.Lng))
+	query.Add("point", fmt.Sprintf("%f,%f", toLatLng.Lat, toLatLng.Lng))
+	query.Set("vehicle", "bike")
+	query.Set("locale", "en")
+	query.Set("points_encoded", "false")
+
+	ghRoute := &graphHopperRoute{}
+	if err := gh.get(ctx, graphHopperRouteURL, query, ghRoute); err != nil {
+		return nil, err
+	}
+
+	if ghRoute.Message != "" || len(ghRoute.Paths) == 0 {
+		return nil, NewUnavailableError(gh.Name(), "no route: "+ghRoute.Message)
+	}
+
+	path := ghRoute.Paths[0]
+
+	route := &models.Directions{Provider: gh.Name()}
+	route.Route.Distance = path.Distance / 1000
+	route.Route.Locations = []models.Location{
+		{LatLng: *fromLatLng},
+		{LatLng: *toLatLng},
+	}
+	route.Info.Copyright.Text = strings.Join(ghRoute.Info.Copyrights, ", ")
+
+	leg := models.Leg{}
+	for _, instruction := range path.Instructions {
+		maneuver := models.Maneuver{Narrative: instruction.Text}
+
+		if len(instruction.Interval) > 0 && instruction.Interval[0] < len(path.Points.Coordinates) {
+			point := path.Points.Coordinates[instruction.Interval[0]]
+			if len(point) >= 2 {
+				maneuver.StartPoint = models.LatLng{Lng: point[0], Lat: point[1]}
+			}
+		}
+
+		leg.Maneuvers = append(leg.Maneuvers, maneuver)
+	}
+	route.Route.Legs = []models.Leg{leg}
+
+	return route, nil
+}
+
+func (gh *graphHopper) Geocode(ctx context.Context, location string) (*models.LatLng, error) {
+
+	query := url.Values{}
+	query.Set("q", location)
+	query.Set("limit", "1")
+	query.Set("locale", "en")
+
+	geocode := &graphHopperGeocode{}
+	if err := gh.get(ctx, graphHopperGeocodeURL, query, geocode); err != nil {
+		return nil, err
+	}
+
+	if geocode.Message != "" {
+		return nil, NewUnavailableError(gh.Name(), geocode.Message)
+	}
+
+	if len(geocode.Hits) == 0 {
+		return nil, NewNotFoundError(gh.Name(), location)
+	}
+
+	return &geocode.Hits[0].Point, nil
+}
+
+func (gh *graphHopper) resolve(ctx context.Context, location string) (*models.LatLng, error) {
+
+	if latLng, ok := ParseLatLng(location); ok {
+		return latLng, nil
+	}
+
+	return gh.Geocode(ctx, location)
+}
+
+// get sends a GET request and decodes the JSON response into v
+func (gh *graphHopper) get(ctx context.Context, base string, query url.Values, v interface{}) error {
+
+	query.Set("key", gh.apiKey)
+
+	req, err := http.NewRequest("GET", base+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := gh.client.Do(ctx, req)
+	if err != nil {
+		return NewUnavailableError(gh.Name(), upstream.StripURL(err).Error())
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return NewUnavailableError(gh.Name(), "response/Decode: "+err.Error())
+	}
+
+	return nil
+}
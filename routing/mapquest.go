@@ -0,0 +1,218 @@
+package routing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/models"
+	"github.com/nimbo-stratuz/bikeshare-directions/upstream"
+)
+
+// mapQuest is a Provider using the MapQuest Directions and Geocoding APIs
+type mapQuest struct {
+	apiKey string
+	client *upstream.Client
+}
+
+const (
+	maxCandidates = 5
+
+	mapQuestDirectionsURL = "https://www.mapquestapi.com/directions/v2/route"
+	mapQuestGeocodingURL  = "https://www.mapquestapi.com/geocoding/v1/address"
+)
+
+// NewMapQuest creates a Provider using the MapQuest APIs
+func NewMapQuest(apiKey string, client *upstream.Client) Provider {
+	return &mapQuest{
+		apiKey: apiKey,
+		client: client,
+	}
+}
+
+func (mq *mapQuest) Name() string {
+	return "mapquest"
+}
+
+func (mq *mapQuest) Route(ctx context.Context, from, to string) (*models.Directions, error) {
+
+	directionsBody := models.DirectionsRequest{
+		Locations: []string{from, to},
+		Options: models.DirectionsRequestOptions{
+			RouteType: "bicycle",
+			Unit:      "k",
+		},
+	}
+
+	body := new(bytes.Buffer)
+	if err := json.NewEncoder(body).Encode(directionsBody); err != nil {
+		return nil, fmt.Errorf("MapQuest request/Encode: %s", err)
+	}
+
+	req, err := http.NewRequest("POST", mq.url(mapQuestDirectionsURL, nil), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	// Computing a route has no side effects
+	req = upstream.Idempotent(req)
+
+	route := &models.Directions{}
+	if err := mq.do(ctx, req, route); err != nil {
+		return nil, err
+	}
+
+	if route.Info.Statuscode != 0 {
+		return nil, NewStatusError(mq.Name(), route.Info.Statuscode)
+	}
+
+	// Addresses resolved to a whole region give misleading routes. The
+	// origin must be more precise than a city, to find a bicycle near it.
+	for i, location := range []string{from, to} {
+		if i >= len(route.Route.Locations) {
+			break
+		}
+
+		if _, ok := ParseLatLng(location); !ok && coarse(route.Route.Locations[i].GeocodeQualityCode, i == 0) {
+			return nil, mq.ambiguous(ctx, location)
+		}
+	}
+
+	route.Provider = mq.Name()
+
+	return route, nil
+}
+
+func (mq *mapQuest) Geocode(ctx context.Context, location string) (*models.LatLng, error) {
+
+	locations, err := mq.geocode(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	// Locations are geocoded to find bicycles near origins
+	if coarse(locations[0].GeocodeQualityCode, true) {
+		return nil, NewAmbiguousLocationError(mq.Name(), location, candidates(locations))
+	}
+
+	return &locations[0].LatLng, nil
+}
+
+// geocode returns up to maxCandidates matches for the location, best first
+func (mq *mapQuest) geocode(ctx context.Context, location string) ([]models.Location, error) {
+
+	query := url.Values{}
+	query.Set("location", location)
+	query.Set("maxResults", strconv.Itoa(maxCandidates))
+
+	req, err := http.NewRequest("GET", mq.url(mapQuestGeocodingURL, query), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	geocode := &models.Geocode{}
+	if err := mq.do(ctx, req, geocode); err != nil {
+		return nil, err
+	}
+
+	if geocode.Info.Statuscode != 0 {
+		return nil, NewStatusError(mq.Name(), geocode.Info.Statuscode)
+	}
+
+	if len(geocode.Results) == 0 || len(geocode.Results[0].Locations) == 0 {
+		return nil, NewNotFoundError(mq.Name(), location)
+	}
+
+	return geocode.Results[0].Locations, nil
+}
+
+// ambiguous creates an AmbiguousLocationError, with candidates for the
+// location if they can be found. Looking them up is one more transaction.
+func (mq *mapQuest) ambiguous(ctx context.Context, location string) error {
+
+	locations, err := mq.geocode(ctx, location)
+
+	ale := NewAmbiguousLocationError(mq.Name(), location, nil)
+	if err == nil {
+		ale.Candidates = candidates(locations)
+	}
+	if billed(err) {
+		ale.lookups = 1
+	}
+
+	return ale
+}
+
+// coarse reports whether a MapQuest geocode quality code
+// (https://developer.mapquest.com/documentation/geocoding-api/quality-codes/)
+// has a granularity of a county, state or country. For origins, a city
+// or a ZIP code is coarse too.
+func coarse(qualityCode string, origin bool) bool {
+	if len(qualityCode) < 2 {
+		return false
+	}
+
+	switch qualityCode[:2] {
+	case "A1", "A3", "A4":
+		return true
+	case "A5", "Z1":
+		return origin
+	default:
+		return false
+	}
+}
+
+func candidates(locations []models.Location) []models.LocationCandidate {
+
+	var matches []models.LocationCandidate
+
+	for _, location := range locations {
+
+		var parts []string
+		for _, part := range []string{location.Street, location.AdminArea5, location.AdminArea3, location.AdminArea1} {
+			if part != "" {
+				parts = append(parts, part)
+			}
+		}
+
+		matches = append(matches, models.LocationCandidate{
+			Label:          strings.Join(parts, ", "),
+			LatLng:         location.LatLng,
+			GeocodeQuality: location.GeocodeQuality,
+		})
+	}
+
+	return matches
+}
+
+func (mq *mapQuest) url(base string, query url.Values) string {
+
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("key", mq.apiKey)
+
+	return base + "?" + query.Encode()
+}
+
+// do sends the request and decodes the JSON response into v
+func (mq *mapQuest) do(ctx context.Context, req *http.Request, v interface{}) error {
+
+	resp, err := mq.client.Do(ctx, req)
+	if err != nil {
+		return NewUnavailableError(mq.Name(), upstream.StripURL(err).Error())
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return NewUnavailableError(mq.Name(), "response/Decode: "+err.Error())
+	}
+
+	return nil
+}
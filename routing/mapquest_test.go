@@ -0,0 +1,33 @@
+package routing
+
+import "testing"
+
+func TestCoarse(t *testing.T) {
+
+	tests := []struct {
+		qualityCode string
+		origin      bool
+		want        bool
+	}{
+		{"P1AAA", false, false}, // Point
+		{"L1AAA", false, false}, // Address
+		{"B1AAA", false, false}, // Street
+		{"Z1XAA", false, false}, // ZIP code
+		{"A5XAX", false, false}, // City, e.g. "to": "Medvode"
+		{"A4XAX", false, true},  // County
+		{"A3XAX", false, true},  // State
+		{"A1XAX", false, true},  // Country
+		{"P1AAA", true, false},
+		{"Z1XAA", true, true},
+		{"A5XAX", true, true},
+		{"A1XAX", true, true},
+		{"", true, false},
+		{"A", true, false},
+	}
+
+	for _, test := range tests {
+		if got := coarse(test.qualityCode, test.origin); got != test.want {
+			t.Errorf("coarse(%q, origin: %v) = %v, want %v", test.qualityCode, test.origin, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package routing
+
+import (
+	"context"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/models"
+	"github.com/nimbo-stratuz/bikeshare-directions/quota"
+)
+
+// metered is a Provider that counts transactions with the underlying
+// provider and stops calling it once its hard budget is exceeded
+type metered struct {
+	provider   Provider
+	accountant *quota.Accountant
+}
+
+// NewMetered creates a Provider that records calls to provider with the
+// accountant. When a soft or hard budget of the provider is exceeded,
+// calls fail with a QuotaExceededError, so a failover Provider can use
+// the next one.
+func NewMetered(provider Provider, accountant *quota.Accountant) Provider {
+	return &metered{
+		provider:   provider,
+		accountant: accountant,
+	}
+}
+
+func (m *metered) Name() string {
+	return m.provider.Name()
+}
+
+func (m *metered) Route(ctx context.Context, from, to string) (*models.Directions, error) {
+
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+
+	route, err := m.provider.Route(ctx, from, to)
+	m.record(err)
+
+	return route, err
+}
+
+func (m *metered) Geocode(ctx context.Context, location string) (*models.LatLng, error) {
+
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+
+	latLng, err := m.provider.Geocode(ctx, location)
+	m.record(err)
+
+	return latLng, err
+}
+
+// check returns a QuotaExceededError if a budget of the provider is exceeded
+func (m *metered) check() error {
+
+	switch m.accountant.Check(m.Name()) {
+	case quota.SoftExceeded:
+		return NewQuotaExceededError(m.Name(), "soft")
+	case quota.HardExceeded:
+		return NewQuotaExceededError(m.Name(), "hard")
+	default:
+		return nil
+	}
+}
+
+// record counts calls answered by the provider, including lookups of
+// candidates for ambiguous locations
+func (m *metered) record(err error) {
+
+	if !billed(err) {
+		return
+	}
+
+	m.accountant.Record(m.Name())
+
+	if ale, ok := err.(*AmbiguousLocationError); ok {
+		for i := 0; i < ale.lookups; i++ {
+			m.accountant.Record(m.Name())
+		}
+	}
+}
+
+// billed reports whether a call was answered by the provider. Calls that
+// never reached it (e.g. network errors) are not billed.
+func billed(err error) bool {
+	switch err.(type) {
+	case nil, *StatusError, *NotFoundError, *AmbiguousLocationError:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,131 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/models"
+	"github.com/nimbo-stratuz/bikeshare-directions/quota"
+)
+
+// fakeProvider returns err from all calls
+type fakeProvider struct {
+	err error
+}
+
+func (fp *fakeProvider) Name() string {
+	return "fake"
+}
+
+func (fp *fakeProvider) Route(ctx context.Context, from, to string) (*models.Directions, error) {
+	if fp.err != nil {
+		return nil, fp.err
+	}
+	return &models.Directions{}, nil
+}
+
+func (fp *fakeProvider) Geocode(ctx context.Context, location string) (*models.LatLng, error) {
+	if fp.err != nil {
+		return nil, fp.err
+	}
+	return &models.LatLng{}, nil
+}
+
+func TestMeteredRecords(t *testing.T) {
+
+	ambiguous := NewAmbiguousLocationError("fake", "Ljubljana", nil)
+
+	lookedUp := NewAmbiguousLocationError("fake", "Ljubljana", nil)
+	lookedUp.lookups = 1
+
+	tests := []struct {
+		err  error
+		want int // Recorded transactions
+	}{
+		{nil, 1},
+		{NewStatusError("fake", 403), 1},
+		{NewNotFoundError("fake", "Nowhere"), 1},
+		{ambiguous, 1},
+		{lookedUp, 2},
+		{NewUnavailableError("fake", "connection refused"), 0},
+		{errors.New("unexpected"), 0},
+	}
+
+	for _, test := range tests {
+		accountant := quota.New(nil, nil, time.Hour)
+		provider := NewMetered(&fakeProvider{err: test.err}, accountant)
+
+		provider.Route(context.Background(), "from", "to")
+
+		if daily, monthly := accountant.Usage("fake"); daily != test.want || monthly != test.want {
+			t.Errorf("Route() error %v: recorded %d, %d, want %d", test.err, daily, monthly, test.want)
+		}
+
+		accountant.Close()
+	}
+}
+
+func TestMeteredHardLimit(t *testing.T) {
+
+	accountant := quota.New(nil, map[string]quota.Budget{"fake": {DailyHard: 1}}, time.Hour)
+	defer accountant.Close()
+
+	provider := NewMetered(&fakeProvider{}, accountant)
+
+	if _, err := provider.Geocode(context.Background(), "Ljubljana"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := provider.Route(context.Background(), "from", "to"); err == nil {
+		t.Fatal("Route() over the hard limit succeeded")
+	} else if _, ok := err.(*QuotaExceededError); !ok {
+		t.Errorf("Route() error = %T, want *QuotaExceededError", err)
+	}
+}
+
+func TestMeteredSoftLimit(t *testing.T) {
+
+	budgets := map[string]quota.Budget{"fake": {DailySoft: 1, DailyHard: 10}}
+
+	accountant := quota.New(nil, budgets, time.Hour)
+	defer accountant.Close()
+
+	metered := NewMetered(&fakeProvider{}, accountant)
+
+	if _, err := metered.Route(context.Background(), "from", "to"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Over the soft limit, the provider is skipped
+	if _, err := metered.Route(context.Background(), "from", "to"); err == nil {
+		t.Fatal("Route() over the soft limit succeeded")
+	} else if _, ok := err.(*QuotaExceededError); !ok {
+		t.Errorf("Route() error = %T, want *QuotaExceededError", err)
+	}
+
+	// and the next provider is used instead
+	provider := NewFailover(metered, &secondProvider{})
+
+	route, err := provider.Route(context.Background(), "from", "to")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if route.Provider != "second" {
+		t.Errorf("route computed by %q, want second", route.Provider)
+	}
+
+	if daily, _ := accountant.Usage("fake"); daily != 1 {
+		t.Errorf("recorded %d transactions over the soft limit, want 1", daily)
+	}
+}
+
+// secondProvider computes routes named after it
+type secondProvider struct {
+	fakeProvider
+}
+
+func (sp *secondProvider) Route(ctx context.Context, from, to string) (*models.Directions, error) {
+	return &models.Directions{Provider: "second"}, nil
+}
@@ -0,0 +1,38 @@
+package routing
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/models"
+)
+
+// Provider is an interface for routing APIs that compute
+// bicycle directions between two locations
+type Provider interface {
+	Name() string                                                           // Name identifies the provider in logs and metrics
+	Route(ctx context.Context, from, to string) (*models.Directions, error) // Route computes directions from one location to another
+	Geocode(ctx context.Context, location string) (*models.LatLng, error)   // Geocode resolves a location to coordinates
+}
+
+// ParseLatLng parses locations given as coordinates ("46.05,14.47")
+func ParseLatLng(location string) (*models.LatLng, bool) {
+
+	parts := strings.Split(location, ",")
+	if len(parts) != 2 {
+		return nil, false
+	}
+
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return nil, false
+	}
+
+	lng, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil || lng < -180 || lng > 180 {
+		return nil, false
+	}
+
+	return &models.LatLng{Lat: lat, Lng: lng}, true
+}
@@ -0,0 +1,54 @@
+package routing
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/models"
+)
+
+// Swappable is a Provider whose underlying Provider can be replaced
+// at runtime, e.g. after a configuration change. Calls in progress
+// finish with the previous Provider.
+type Swappable struct {
+	mutex    *sync.RWMutex
+	provider Provider
+}
+
+// NewSwappable creates a Swappable that delegates to provider
+func NewSwappable(provider Provider) *Swappable {
+	return &Swappable{
+		mutex:    &sync.RWMutex{},
+		provider: provider,
+	}
+}
+
+// Swap replaces the underlying Provider
+func (s *Swappable) Swap(provider Provider) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.provider = provider
+}
+
+func (s *Swappable) current() Provider {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.provider
+}
+
+// Name of the current Provider
+func (s *Swappable) Name() string {
+	return s.current().Name()
+}
+
+// Route finds directions with the current Provider
+func (s *Swappable) Route(ctx context.Context, from, to string) (*models.Directions, error) {
+	return s.current().Route(ctx, from, to)
+}
+
+// Geocode finds a location with the current Provider
+func (s *Swappable) Geocode(ctx context.Context, location string) (*models.LatLng, error) {
+	return s.current().Geocode(ctx, location)
+}
@@ -0,0 +1,53 @@
+package routing
+
+import (
+	"context"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/models"
+	"github.com/nimbo-stratuz/bikeshare-directions/tracing"
+	"github.com/nimbo-stratuz/bikeshare-directions/upstream"
+)
+
+// traced is a Provider that records a span for every call
+type traced struct {
+	provider Provider
+}
+
+// NewTraced creates a Provider that traces calls to provider
+func NewTraced(provider Provider) Provider {
+	return &traced{provider: provider}
+}
+
+func (t *traced) Name() string {
+	return t.provider.Name()
+}
+
+func (t *traced) Route(ctx context.Context, from, to string) (*models.Directions, error) {
+
+	ctx, span := tracing.StartSpan(ctx, "routing."+t.provider.Name()+".Route", tracing.KindInternal)
+	defer span.End()
+
+	span.SetAttribute("routing.provider", t.provider.Name())
+
+	route, err := t.provider.Route(ctx, from, to)
+	if err != nil {
+		span.SetError(upstream.StripURL(err))
+	}
+
+	return route, err
+}
+
+func (t *traced) Geocode(ctx context.Context, location string) (*models.LatLng, error) {
+
+	ctx, span := tracing.StartSpan(ctx, "routing."+t.provider.Name()+".Geocode", tracing.KindInternal)
+	defer span.End()
+
+	span.SetAttribute("routing.provider", t.provider.Name())
+
+	latLng, err := t.provider.Geocode(ctx, location)
+	if err != nil {
+		span.SetError(upstream.StripURL(err))
+	}
+
+	return latLng, err
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/config"
+	"github.com/nimbo-stratuz/bikeshare-directions/logging"
+)
+
+// ConfigEntry is the effective value of a config key
+type ConfigEntry struct {
+	Key      string
+	Value    string
+	Source   string // Name of the source providing the value, empty if not set
+	Writable bool   // SetConfig takes effect
+}
+
+// UnknownConfigKeyError is returned for keys not declared in the schema
+type UnknownConfigKeyError struct {
+	Key string
+}
+
+func (e *UnknownConfigKeyError) Error() string {
+	return "Unknown config key: " + e.Key
+}
+
+// OverriddenConfigKeyError is returned when setting a key whose value
+// comes from a source of higher priority than etcd
+type OverriddenConfigKeyError struct {
+	Key    string
+	Source string
+}
+
+func (e *OverriddenConfigKeyError) Error() string {
+	return fmt.Sprintf("%s is set in %s, which takes priority over etcd", e.Key, e.Source)
+}
+
+// DescribeConfig returns the effective value of key and its source.
+// Secret values are redacted, unless showSecrets is set.
+func DescribeConfig(key string, showSecrets bool) ConfigEntry {
+
+	path := strings.Split(key, ".")
+	entry := ConfigEntry{Key: key, Writable: true}
+
+	value, err := Config.Get(path...)
+	if err != nil {
+		return entry
+	}
+
+	if sourced, ok := Config.(config.Sourced); ok {
+		entry.Source, _ = sourced.Source(path...)
+	}
+
+	// Environment variables and secret files take priority over etcd
+	entry.Writable = entry.Source != "env" && entry.Source != "secrets"
+
+	switch {
+	case showSecrets:
+		entry.Value = value
+	case entry.Source == "secrets":
+		entry.Value = logging.Redacted
+	default:
+		entry.Value = config.RedactValue(key, value)
+	}
+
+	return entry
+}
+
+// SetConfig checks value against the schema and writes it to etcd
+// (WritableConfig)
+func SetConfig(key, value string) error {
+
+	field, ok := ConfigSchema().Field(key)
+	if !ok {
+		return &UnknownConfigKeyError{Key: key}
+	}
+
+	if err := field.ValidateValue(value); err != nil {
+		return err
+	}
+
+	if entry := DescribeConfig(key, false); !entry.Writable {
+		return &OverriddenConfigKeyError{Key: key, Source: entry.Source}
+	}
+
+	_, err := WritableConfig.Put(strings.Replace(key, ".", "/", -1), value)
+
+	return err
+}
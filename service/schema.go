@@ -0,0 +1,101 @@
+package service
+
+import (
+	"github.com/nimbo-stratuz/bikeshare-directions/config"
+)
+
+// configSchema declares the config keys of the service. Keys of routing
+// providers are declared by providerSchema.
+var configSchema = config.Schema{
+	{Key: "env", Type: config.TypeString, Required: true},
+	{Key: "name", Type: config.TypeString, Required: true},
+	{Key: "version", Type: config.TypeString, Required: true},
+
+	{Key: "server.port", Type: config.TypeInt, Required: true, Min: config.Bound(1), Max: config.Bound(65535)},
+	{Key: "server.baseurl", Type: config.TypeURL, Required: true},
+
+	{Key: "config.etcd.url", Type: config.TypeURL, Required: true},
+	{Key: "config.etcd.api", Type: config.TypeString, Default: "v2", OneOf: []string{"v2", "v3"}},
+	{Key: "config.etcd.layout", Type: config.TypeString, Default: "raw", OneOf: []string{"raw", "kumuluzee"}},
+	// Prefix of environment variables, e.g. BIKESHARE_DIRECTIONS_
+	{Key: "config.env.prefix", Type: config.TypeString},
+	{Key: "discovery.etcd.url", Type: config.TypeURL, Required: true},
+
+	// Bearer token of /admin, which is disabled if it is not set
+	{Key: "admin.token", Type: config.TypeString},
+
+	{Key: "routing.providers", Type: config.TypeStringSlice, Default: "mapquest", OneOf: []string{"mapquest", "graphhopper"}},
+	{Key: "quota.flush", Type: config.TypeInt, Default: "10", Min: config.Bound(1)},
+
+	{Key: "cache.ttl", Type: config.TypeInt, Default: "3600", Min: config.Bound(1)},
+	{Key: "cache.local.size", Type: config.TypeInt, Default: "1000", Min: config.Bound(1)},
+	{Key: "cache.redis.url", Type: config.TypeURL},
+	{Key: "cache.redis.timeout", Type: config.TypeInt, Default: "200", Min: config.Bound(1)},
+
+	{Key: "upstream.timeout", Type: config.TypeInt, Default: "2500", Min: config.Bound(1)},
+
+	{Key: "health.cache", Type: config.TypeInt, Default: "5000"},
+	{Key: "health.etcd.timeout", Type: config.TypeInt, Default: "1000", Min: config.Bound(1)},
+	{Key: "health.discovery.timeout", Type: config.TypeInt, Default: "1000", Min: config.Bound(1)},
+	{Key: "health.catalogue.timeout", Type: config.TypeInt, Default: "1000", Min: config.Bound(1)},
+	{Key: "health.redis.timeout", Type: config.TypeInt, Default: "1000", Min: config.Bound(1)},
+
+	{Key: "tracing.exporter", Type: config.TypeString, Default: "none", OneOf: []string{"none", "stdout", "otlp"}},
+	{Key: "tracing.sampler.percent", Type: config.TypeInt, Default: "100", Min: config.Bound(0), Max: config.Bound(100)},
+	{Key: "tracing.otlp.url", Type: config.TypeURL, Default: "http://localhost:4318/v1/traces"},
+	{Key: "tracing.otlp.timeout", Type: config.TypeInt, Default: "5000", Min: config.Bound(1)},
+}
+
+// providerPrefixes are the prefixes of the API key and upstream options
+// of routing providers
+var providerPrefixes = map[string]string{
+	"mapquest":    "maps",
+	"graphhopper": "graphhopper",
+}
+
+// providerSchema declares the config keys of the routing providers
+// in use, and of the catalogue upstream
+func providerSchema(providers []string) config.Schema {
+
+	schema := upstreamSchema("catalogue")
+
+	for _, provider := range providers {
+		prefix, ok := providerPrefixes[provider]
+		if !ok {
+			// Reported by configSchema
+			continue
+		}
+
+		schema = append(schema, config.Field{Key: prefix + ".api.key", Type: config.TypeString, Required: true})
+		schema = append(schema, upstreamSchema(prefix)...)
+
+		for _, period := range []string{"daily", "monthly"} {
+			for _, limit := range []string{"soft", "hard"} {
+				schema = append(schema, config.Field{
+					Key:  "quota." + provider + "." + period + "." + limit,
+					Type: config.TypeInt,
+					Min:  config.Bound(0),
+				})
+			}
+		}
+	}
+
+	return schema
+}
+
+// upstreamSchema declares the keys of upstream.Options under
+// upstream.<name>. Their defaults are in upstream.Options.
+func upstreamSchema(name string) config.Schema {
+
+	prefix := "upstream." + name + "."
+
+	return config.Schema{
+		{Key: prefix + "timeout", Type: config.TypeDuration, Min: config.Bound(1)},
+		{Key: prefix + "retries", Type: config.TypeInt, Min: config.Bound(0)},
+		{Key: prefix + "backoff", Type: config.TypeDuration, Min: config.Bound(0)},
+		{Key: prefix + "maxbackoff", Type: config.TypeDuration, Min: config.Bound(0)},
+		// 0 disables the circuit breaker
+		{Key: prefix + "breaker.threshold", Type: config.TypeInt, Min: config.Bound(0)},
+		{Key: prefix + "breaker.timeout", Type: config.TypeDuration, Min: config.Bound(1)},
+	}
+}
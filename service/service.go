@@ -1,15 +1,24 @@
 package service
 
 import (
+	"fmt"
+	"os"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/google/uuid"
+	"github.com/nimbo-stratuz/bikeshare-directions/cache"
 	"github.com/nimbo-stratuz/bikeshare-directions/config"
 	"github.com/nimbo-stratuz/bikeshare-directions/discovery"
+	"github.com/nimbo-stratuz/bikeshare-directions/health"
+	"github.com/nimbo-stratuz/bikeshare-directions/logging"
+	"github.com/nimbo-stratuz/bikeshare-directions/quota"
+	"github.com/nimbo-stratuz/bikeshare-directions/tracing"
+	"github.com/nimbo-stratuz/bikeshare-directions/upstream"
 
 	etcd2 "go.etcd.io/etcd/client"
+	etcd3 "go.etcd.io/etcd/clientv3"
 )
 
 var (
@@ -21,21 +30,50 @@ var (
 
 	// Discovery ...
 	Discovery discovery.ServiceDiscovery
+
+	// WritableConfig is the etcd config source, used for state shared
+	// between instances
+	WritableConfig config.WritableConfig
+
+	// Cache is shared between instances if cache.redis.url is set,
+	// otherwise local to the process
+	Cache cache.Cache
+
+	// Quota counts transactions with routing providers
+	Quota *quota.Accountant
 )
 
-func init() {
+// Init initializes the config and all services, and registers
+// the service for discovery. It exits if the config is invalid.
+func Init() {
+	InitConfig()
+	validateConfig()
+	initCache()
+	initQuota()
+	initTracing()
+	initDiscovery()
+}
+
+// InitConfig initializes only logging and Config (with WritableConfig),
+// e.g. for commands that do not start the server
+func InitConfig() {
 	initLogging()
 	initConfig()
-	initDiscovery()
 }
 
 func Close() {
 	Discovery.Close()
+	tracing.Stop()
+	Quota.Close()
+	Cache.Close()
 	Config.Close()
 }
 
 func initLogging() {
 	log.SetLevel(log.DebugLevel)
+
+	// Tell apart log lines of different pods
+	logging.AddFields(log.Fields{"instance": InstanceID})
 }
 
 func initConfig() {
@@ -46,7 +84,21 @@ func initConfig() {
 		log.Fatal(err)
 	}
 
-	envConf := config.NewEnvConfig()
+	// Variables for local development, the environment takes priority
+	if err := config.LoadDotEnv(".env"); err == nil {
+		log.Info("Loaded environment variables from .env")
+	} else if !os.IsNotExist(err) {
+		log.Fatal(err)
+	}
+
+	// The prefix of environment variables is read without a prefix
+	prefixConf, err := config.New(config.NewEnvConfig(""), yamlConf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	envPrefix, _ := prefixConf.Get("config", "env", "prefix")
+
+	envConf := config.NewEnvConfig(envPrefix)
 
 	startupConf, err := config.New(
 		envConf,
@@ -56,32 +108,250 @@ func initConfig() {
 		log.Fatal(err)
 	}
 
+	// Secrets mounted as files, e.g. a Kubernetes secret volume
+	configs := []config.Config{envConf}
+	if secretsDir, err := startupConf.Get("config", "secrets", "dir"); err == nil {
+		secretConf, err := config.NewSecretFileConfig(secretsDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		configs = append(configs, secretConf)
+	}
+
 	etcdURL, err := startupConf.Get("config", "etcd", "url")
 	if err != nil {
 		log.Fatal("config.etcd.url not specified")
 	}
 
-	etcd2Conf, err := config.NewEtcd2Config(
-		etcd2.Config{
-			Endpoints:               []string{etcdURL},
-			Transport:               etcd2.DefaultTransport,
-			HeaderTimeoutPerRequest: time.Second,
-		},
-	)
+	etcdConf, err := newEtcdConfig(startupConf, etcdURL)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	Config, err = config.New(
-		// highest priority
-		envConf,
-		etcd2Conf,
-		yamlConf,
-		// lowest priority
+	WritableConfig = etcdConf
+
+	// Highest priority first: env, secrets, etcd, config.yaml, defaults
+	configs = append(configs, etcdConf, yamlConf, configSchema.Defaults())
+
+	Config, err = config.New(configs...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	health.Register(
+		health.NewChecker("EtcdConfigHealthCheck", etcdConf.(config.Pinger).Ping),
+		GetHealthOptions("etcd"),
 	)
+}
+
+// ConfigSchema returns the declared config keys of the service,
+// including those of the routing providers in use
+func ConfigSchema() config.Schema {
+
+	schema := append(config.Schema{}, configSchema...)
+	return append(schema, providerSchema(GetRoutingProviders())...)
+}
+
+// validateConfig checks the config against the schema, and exits
+// listing all problems if it is invalid
+func validateConfig() {
+
+	err := ConfigSchema().Validate(Config)
+	if err == nil {
+		return
+	}
+
+	verr, ok := err.(*config.ValidationError)
+	if !ok {
+		log.Fatal(err)
+	}
+
+	for _, problem := range verr.Problems {
+		log.WithField("key", problem.Key).Error("Invalid config: ", problem.Message)
+	}
+
+	log.Fatalf("Invalid config: %d problem(s), see above", len(verr.Problems))
+}
+
+// newEtcdConfig creates the etcd config source for the API version in
+// config.etcd.api (v2 by default) and the key layout in config.etcd.layout
+func newEtcdConfig(startupConf config.Config, etcdURL string) (config.WritableConfig, error) {
+
+	api, err := startupConf.Get("config", "etcd", "api")
+	if err != nil {
+		api = "v2"
+	}
+
+	layout, err := newKeyLayout(startupConf, api)
+	if err != nil {
+		return nil, err
+	}
+
+	switch api {
+	case "v2":
+		return config.NewEtcd2Config(
+			etcd2.Config{
+				Endpoints:               []string{etcdURL},
+				Transport:               etcd2.DefaultTransport,
+				HeaderTimeoutPerRequest: time.Second,
+			},
+			layout,
+		)
+
+	case "v3":
+		return config.NewEtcdConfig(
+			layout,
+			etcd3.Config{
+				Endpoints: []string{etcdURL},
+			},
+		)
+
+	default:
+		return nil, fmt.Errorf("Unknown config.etcd.api %q (v2, v3)", api)
+	}
+}
+
+// newKeyLayout returns the layout of keys in etcd. The raw layout has keys
+// at the root (v2) or under /<env>/<name>/<version> (v3), the kumuluzee
+// layout has them under /environments/<env>/services/<name>/<version>/config,
+// like the Java services using KumuluzEE config.
+func newKeyLayout(startupConf config.Config, api string) (config.KeyLayout, error) {
+
+	layout, err := startupConf.Get("config", "etcd", "layout")
+	if err != nil {
+		layout = "raw"
+	}
+
+	// KumuluzEE defaults
+	env, err := startupConf.Get("env")
+	if err != nil {
+		env = "dev"
+	}
+	name, err := startupConf.Get("name")
+	if err != nil {
+		return nil, err
+	}
+	version, err := startupConf.Get("version")
+	if err != nil {
+		version = "1.0.0"
+	}
+
+	switch layout {
+	case "raw":
+		if api == "v2" {
+			return config.NewPrefixLayout(""), nil
+		}
+		return config.NewVersionedPrefixLayout(fmt.Sprintf("/%s/%s", env, name), version), nil
+
+	case "kumuluzee":
+		return config.NewKumuluzEELayout(env, name, version), nil
+
+	default:
+		return nil, fmt.Errorf("Unknown config.etcd.layout %q (raw, kumuluzee)", layout)
+	}
+}
+
+func initCache() {
+	log.Println("Initializing Cache")
+
+	size, err := Config.GetInt("cache", "local", "size")
+	if err != nil {
+		size = 1000
+	}
+
+	Cache = cache.NewInstrumented("local", cache.NewLocal(size))
+
+	redisURL, err := Config.Get("cache", "redis", "url")
+	if err != nil {
+		log.Info("cache.redis.url not specified, using local cache only")
+		return
+	}
+
+	timeout, err := Config.GetInt("cache", "redis", "timeout")
+	if err != nil {
+		timeout = 200
+	}
+
+	redisCache, err := cache.NewRedis(redisURL, GetName()+":", time.Duration(timeout)*time.Millisecond)
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	Cache = cache.NewFallback(
+		Cache,
+		cache.NewInstrumented("shared", redisCache),
+		GetCacheTTL(),
+		30*time.Second,
+	)
+
+	health.Register(Cache.(health.HealthChecker), GetHealthOptions("redis"))
+}
+
+func initQuota() {
+	log.Println("Initializing Quota")
+
+	budgets := make(map[string]quota.Budget)
+
+	for _, provider := range GetRoutingProviders() {
+		budgets[provider] = quota.Budget{
+			DailySoft:   getIntDefault(0, "quota", provider, "daily", "soft"),
+			DailyHard:   getIntDefault(0, "quota", provider, "daily", "hard"),
+			MonthlySoft: getIntDefault(0, "quota", provider, "monthly", "soft"),
+			MonthlyHard: getIntDefault(0, "quota", provider, "monthly", "hard"),
+		}
+	}
+
+	flush := getIntDefault(10, "quota", "flush")
+
+	// Counters are shared between instances through etcd
+	counter, _ := WritableConfig.(config.Counter)
+
+	Quota = quota.New(counter, budgets, time.Duration(flush)*time.Second)
+}
+
+func initTracing() {
+	log.Println("Initializing Tracing")
+
+	exporter, err := Config.Get("tracing", "exporter")
+	if err != nil {
+		exporter = "none"
+	}
+
+	percent := getIntDefault(100, "tracing", "sampler", "percent")
+
+	switch exporter {
+
+	case "none":
+		return
+
+	case "stdout":
+		tracing.Start(tracing.NewWriterExporter(os.Stdout), float64(percent)/100)
+
+	case "otlp":
+		url, err := Config.Get("tracing", "otlp", "url")
+		if err != nil {
+			url = "http://localhost:4318/v1/traces"
+		}
+
+		timeout := getIntDefault(5000, "tracing", "otlp", "timeout")
+
+		version, _ := Config.Get("version")
+
+		resource := map[string]string{
+			"service.name":           GetName(),
+			"service.version":        version,
+			"service.instance.id":    InstanceID,
+			"deployment.environment": GetEnv(),
+		}
+
+		tracing.Start(
+			tracing.NewOTLPExporter(url, resource, time.Duration(timeout)*time.Millisecond),
+			float64(percent)/100,
+		)
+
+	default:
+		log.Fatalf("Unknown tracing exporter: %s", exporter)
+	}
 }
 
 func initDiscovery() {
@@ -110,6 +380,11 @@ func initDiscovery() {
 			log.Fatal(err)
 		}
 	}
+
+	health.Register(
+		health.NewChecker("DiscoveryRegistrationHealthCheck", Discovery.Registered),
+		GetHealthOptions("discovery"),
+	)
 }
 
 func GetName() string {
@@ -121,6 +396,56 @@ func GetName() string {
 	return env
 }
 
+// GetRoutingProviders returns the names of routing providers listed
+// in routing.providers, in priority order
+func GetRoutingProviders() []string {
+
+	providers, err := Config.GetStringSlice("routing", "providers")
+	if err != nil {
+		return []string{"mapquest"}
+	}
+
+	return providers
+}
+
+// GetCacheTTL returns the expiration time of cached upstream results
+func GetCacheTTL() time.Duration {
+	ttl, err := Config.GetInt("cache", "ttl")
+	if err != nil {
+		return time.Hour
+	}
+
+	return time.Duration(ttl) * time.Second
+}
+
+// GetUpstreamTimeout returns the time budget for all upstream calls
+// of a single request (upstream.timeout, in milliseconds)
+func GetUpstreamTimeout() time.Duration {
+	return time.Duration(getIntDefault(2500, "upstream", "timeout")) * time.Millisecond
+}
+
+// GetUpstreamOptions returns the options for calls to the specified
+// upstream, configured under upstream.<name> (durations in milliseconds)
+func GetUpstreamOptions(name string) (upstream.Options, error) {
+
+	var options upstream.Options
+	if err := Config.Decode("upstream."+name, &options); err != nil {
+		return options, fmt.Errorf("Invalid options for upstream %s: %s", name, err)
+	}
+
+	return options, nil
+}
+
+// GetHealthOptions returns the options of the specified health check:
+// its timeout (health.<name>.timeout) and the time its result is reused
+// (health.cache), in milliseconds
+func GetHealthOptions(name string) health.Options {
+	return health.Options{
+		Timeout: time.Duration(getIntDefault(1000, "health", name, "timeout")) * time.Millisecond,
+		TTL:     time.Duration(getIntDefault(5000, "health", "cache")) * time.Millisecond,
+	}
+}
+
 func GetEnv() string {
 	env, err := Config.Get("env")
 	if err != nil {
@@ -129,3 +454,12 @@ func GetEnv() string {
 
 	return env
 }
+
+func getIntDefault(def int, key ...string) int {
+	value, err := Config.GetInt(key...)
+	if err != nil {
+		return def
+	}
+
+	return value
+}
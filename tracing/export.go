@@ -0,0 +1,243 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/logging"
+)
+
+// SpanData is an ended span, as seen by exporters
+type SpanData struct {
+	Name         string            `json:"name"`
+	Kind         SpanKind          `json:"kind"`
+	TraceID      string            `json:"traceId"`
+	SpanID       string            `json:"spanId"`
+	ParentSpanID string            `json:"parentSpanId,omitempty"`
+	Start        time.Time         `json:"start"`
+	End          time.Time         `json:"end"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+func (s *Span) data() *SpanData {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sd := &SpanData{
+		Name:       s.name,
+		Kind:       s.kind,
+		TraceID:    hex.EncodeToString(s.context.TraceID[:]),
+		SpanID:     hex.EncodeToString(s.context.SpanID[:]),
+		Start:      s.start,
+		End:        s.end,
+		Attributes: make(map[string]string, len(s.attributes)),
+	}
+
+	if s.parentID != [8]byte{} {
+		sd.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+
+	for k, v := range s.attributes {
+		sd.Attributes[k] = v
+	}
+
+	// Like log lines, errors must not reveal secrets
+	if s.err != nil {
+		sd.Error = logging.Redact(s.err.Error())
+	}
+
+	return sd
+}
+
+// Exporter sends ended spans to a tracing backend
+type Exporter interface {
+	Export(spans []*SpanData) error
+	Close() error
+}
+
+const (
+	queueSize     = 2048
+	batchSize     = 256
+	batchInterval = 5 * time.Second
+)
+
+var (
+	exporterMutex = &sync.Mutex{}
+	exporter      Exporter
+	sampleRatio   = 1.0
+
+	queue chan *Span
+	quit  chan bool
+	done  chan bool
+)
+
+// Start exports sampled spans with e in batches, until Stop is called.
+// Root spans are sampled with probability ratio; child spans follow
+// their parent's decision.
+func Start(e Exporter, ratio float64) {
+	exporterMutex.Lock()
+	defer exporterMutex.Unlock()
+
+	exporter = e
+	sampleRatio = ratio
+	queue = make(chan *Span, queueSize)
+	quit = make(chan bool)
+	done = make(chan bool)
+
+	go export(e, queue, quit, done)
+}
+
+// Stop exports remaining spans and closes the exporter
+func Stop() error {
+	exporterMutex.Lock()
+	defer exporterMutex.Unlock()
+
+	if exporter == nil {
+		return nil
+	}
+
+	close(quit)
+	<-done
+
+	err := exporter.Close()
+	exporter = nil
+
+	return err
+}
+
+func sample() bool {
+	exporterMutex.Lock()
+	defer exporterMutex.Unlock()
+
+	return exporter != nil && rand.Float64() < sampleRatio
+}
+
+func enqueue(s *Span) {
+	exporterMutex.Lock()
+	defer exporterMutex.Unlock()
+
+	if exporter == nil {
+		return
+	}
+
+	select {
+	case queue <- s:
+	default:
+		// Tracing must never slow requests down
+		log.Debug("Tracing queue full, dropping span ", s.name)
+	}
+}
+
+func export(e Exporter, queue chan *Span, quit, done chan bool) {
+
+	defer close(done)
+
+	var batch []*SpanData
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.Export(batch); err != nil {
+			log.Warn("Cannot export spans: ", err)
+		}
+		batch = nil
+	}
+
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case s := <-queue:
+			batch = append(batch, s.data())
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-quit:
+			for {
+				select {
+				case s := <-queue:
+					batch = append(batch, s.data())
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// writerExporter writes spans as JSON lines
+type writerExporter struct {
+	mutex   *sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewWriterExporter creates an Exporter writing spans as JSON lines to w
+// (e.g. os.Stdout)
+func NewWriterExporter(w io.Writer) Exporter {
+	return &writerExporter{
+		mutex:   &sync.Mutex{},
+		encoder: json.NewEncoder(w),
+	}
+}
+
+func (we *writerExporter) Export(spans []*SpanData) error {
+	we.mutex.Lock()
+	defer we.mutex.Unlock()
+
+	for _, span := range spans {
+		if err := we.encoder.Encode(span); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (we *writerExporter) Close() error {
+	return nil
+}
+
+// MemoryExporter keeps exported spans in memory, for tests
+type MemoryExporter struct {
+	mutex *sync.Mutex
+	spans []*SpanData
+}
+
+// NewMemoryExporter creates a MemoryExporter
+func NewMemoryExporter() *MemoryExporter {
+	return &MemoryExporter{mutex: &sync.Mutex{}}
+}
+
+// Export stores spans
+func (me *MemoryExporter) Export(spans []*SpanData) error {
+	me.mutex.Lock()
+	defer me.mutex.Unlock()
+
+	me.spans = append(me.spans, spans...)
+	return nil
+}
+
+// Spans returns all exported spans
+func (me *MemoryExporter) Spans() []*SpanData {
+	me.mutex.Lock()
+	defer me.mutex.Unlock()
+
+	return append([]*SpanData(nil), me.spans...)
+}
+
+// Close does nothing for MemoryExporter
+func (me *MemoryExporter) Close() error {
+	return nil
+}
@@ -0,0 +1,134 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// otlpExporter sends spans to an OpenTelemetry collector using
+// OTLP/HTTP with JSON encoding
+type otlpExporter struct {
+	endpoint   string
+	attributes map[string]string // Resource attributes, including service.name
+
+	client *http.Client
+}
+
+// NewOTLPExporter creates an Exporter sending spans to endpoint
+// (e.g. http://localhost:4318/v1/traces). resource attributes describe
+// the service (service.name, service.version, ...).
+func NewOTLPExporter(endpoint string, resource map[string]string, timeout time.Duration) Exporter {
+	return &otlpExporter{
+		endpoint:   endpoint,
+		attributes: resource,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+type otlpKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            struct {
+		Code    int    `json:"code,omitempty"` // 2 = error
+		Message string `json:"message,omitempty"`
+	} `json:"status"`
+}
+
+func (oe *otlpExporter) Export(spans []*SpanData) error {
+
+	otlpSpans := make([]otlpSpan, len(spans))
+
+	for i, span := range spans {
+		out := otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentSpanID,
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        keyValues(span.Attributes),
+		}
+
+		if span.Error != "" {
+			out.Status.Code = 2
+			out.Status.Message = span.Error
+		}
+
+		otlpSpans[i] = out
+	}
+
+	request := map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": keyValues(oe.attributes),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": "github.com/nimbo-stratuz/bikeshare-directions/tracing"},
+						"spans": otlpSpans,
+					},
+				},
+			},
+		},
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	resp, err := oe.client.Post(oe.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("OTLP collector responded with %s", resp.Status)
+	}
+
+	return nil
+}
+
+func (oe *otlpExporter) Close() error {
+	return nil
+}
+
+func keyValues(attributes map[string]string) []otlpKeyValue {
+
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]otlpKeyValue, len(keys))
+	for i, k := range keys {
+		kvs[i].Key = k
+		kvs[i].Value.StringValue = attributes[k]
+	}
+
+	return kvs
+}
@@ -0,0 +1,209 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader propagates the trace context (W3C Trace Context)
+const TraceparentHeader = "traceparent"
+
+// SpanKind tells the role of a span in a trace (values match OTLP)
+type SpanKind int
+
+const (
+	// KindInternal spans are operations within the service
+	KindInternal SpanKind = 1
+	// KindServer spans handle incoming requests
+	KindServer SpanKind = 2
+	// KindClient spans are calls to other services
+	KindClient SpanKind = 3
+)
+
+// SpanContext identifies a span within a trace
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid reports whether both IDs are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceIDString returns the trace ID in hex
+func (sc SpanContext) TraceIDString() string {
+	return hex.EncodeToString(sc.TraceID[:])
+}
+
+// SpanIDString returns the span ID in hex
+func (sc SpanContext) SpanIDString() string {
+	return hex.EncodeToString(sc.SpanID[:])
+}
+
+// Traceparent formats the SpanContext as a traceparent header value
+func (sc SpanContext) Traceparent() string {
+
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceIDString(), sc.SpanIDString(), flags)
+}
+
+// ParseTraceparent parses a traceparent header value
+func ParseTraceparent(value string) (SpanContext, error) {
+
+	var sc SpanContext
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, fmt.Errorf("Invalid traceparent: %s", value)
+	}
+
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, fmt.Errorf("Invalid traceparent: %s", value)
+	}
+
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, fmt.Errorf("Invalid traceparent: %s", value)
+	}
+
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, fmt.Errorf("Invalid traceparent: %s", value)
+	}
+
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, fmt.Errorf("Invalid traceparent: %s", value)
+	}
+	sc.Sampled = flags[0]&1 == 1
+
+	if !sc.IsValid() {
+		return sc, fmt.Errorf("Invalid traceparent: %s", value)
+	}
+
+	return sc, nil
+}
+
+// Span is a timed operation within a trace
+type Span struct {
+	mutex *sync.Mutex
+
+	name     string
+	kind     SpanKind
+	context  SpanContext
+	parentID [8]byte
+
+	start time.Time
+	end   time.Time
+
+	attributes map[string]string
+	err        error
+	ended      bool
+}
+
+type spanKey struct{}
+
+// StartSpan starts a span, which is a child of the span in ctx (if any).
+// The returned context carries the new span.
+func StartSpan(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+
+	span := newSpan(name, kind)
+
+	if parent := FromContext(ctx); parent != nil {
+		span.context.TraceID = parent.context.TraceID
+		span.context.Sampled = parent.context.Sampled
+		span.parentID = parent.context.SpanID
+	} else {
+		rand.Read(span.context.TraceID[:])
+		span.context.Sampled = sample()
+	}
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// StartRemoteSpan starts a span that continues the trace of remote,
+// e.g. parsed from an incoming traceparent header
+func StartRemoteSpan(ctx context.Context, name string, kind SpanKind, remote SpanContext) (context.Context, *Span) {
+
+	span := newSpan(name, kind)
+	span.context.TraceID = remote.TraceID
+	span.context.Sampled = remote.Sampled
+	span.parentID = remote.SpanID
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func newSpan(name string, kind SpanKind) *Span {
+
+	span := &Span{
+		mutex:      &sync.Mutex{},
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: make(map[string]string),
+	}
+	rand.Read(span.context.SpanID[:])
+
+	return span
+}
+
+// FromContext returns the current span, or nil
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Inject sets the traceparent header for the span in ctx
+func Inject(ctx context.Context, header http.Header) {
+	if span := FromContext(ctx); span != nil {
+		header.Set(TraceparentHeader, span.context.Traceparent())
+	}
+}
+
+// Context returns the SpanContext of the span
+func (s *Span) Context() SpanContext {
+	return s.context
+}
+
+// SetAttribute annotates the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.attributes[key] = fmt.Sprint(value)
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.err = err
+}
+
+// End ends the span and hands it to the exporter, if sampled.
+// Calling End more than once has no effect.
+func (s *Span) End() {
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mutex.Unlock()
+
+	if s.context.Sampled {
+		enqueue(s)
+	}
+}
@@ -0,0 +1,140 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/logging"
+)
+
+func TestParseTraceparent(t *testing.T) {
+
+	tests := []struct {
+		value   string
+		sampled bool
+		err     bool
+	}{
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sampled: true},
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+		{value: " 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01 ", sampled: true},
+		{value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", sampled: true},
+		{value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", err: true},
+		{value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", err: true},
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", err: true},
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01", err: true},
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01", err: true},
+		{value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", err: true},
+		{value: "", err: true},
+	}
+
+	for _, test := range tests {
+		sc, err := ParseTraceparent(test.value)
+		if test.err {
+			if err == nil {
+				t.Errorf("ParseTraceparent(%q) succeeded, want an error", test.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseTraceparent(%q) error = %v", test.value, err)
+			continue
+		}
+
+		if sc.Sampled != test.sampled {
+			t.Errorf("ParseTraceparent(%q) sampled = %v, want %v", test.value, sc.Sampled, test.sampled)
+		}
+		if sc.TraceIDString() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanIDString() != "00f067aa0ba902b7" {
+			t.Errorf("ParseTraceparent(%q) = %s", test.value, sc.Traceparent())
+		}
+	}
+}
+
+func TestSpanExport(t *testing.T) {
+
+	exporter := NewMemoryExporter()
+	Start(exporter, 1)
+
+	logging.AddSecret("s3cr3t-api-key")
+
+	ctx, parent := StartSpan(context.Background(), "parent", KindServer)
+	_, child := StartSpan(ctx, "child", KindClient)
+	child.SetAttribute("retries", 2)
+	child.SetError(errors.New("cannot call https://example.com/?key=s3cr3t-api-key"))
+	child.End()
+	parent.End()
+	parent.End()
+
+	Stop()
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("%d spans exported, want 2", len(spans))
+	}
+
+	childData, parentData := spans[0], spans[1]
+
+	if childData.TraceID != parentData.TraceID || childData.ParentSpanID != parentData.SpanID {
+		t.Errorf("child %s/%s is not a child of %s/%s",
+			childData.TraceID, childData.ParentSpanID, parentData.TraceID, parentData.SpanID)
+	}
+	if childData.Attributes["retries"] != "2" {
+		t.Errorf("retries = %q, want 2", childData.Attributes["retries"])
+	}
+	if childData.Error != "cannot call https://example.com/?key="+logging.Redacted {
+		t.Errorf("error = %q, want the secret redacted", childData.Error)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+
+	requests := make(chan map[string]interface{}, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		var request map[string]interface{}
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Error(err)
+		}
+		requests <- request
+	}))
+	defer server.Close()
+
+	exporter := NewOTLPExporter(server.URL, map[string]string{"service.name": "bikeshare-directions"}, time.Second)
+
+	err := exporter.Export([]*SpanData{{Name: "span", TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", Error: "failed"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []otlpKeyValue `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []otlpSpan `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	encoded, _ := json.Marshal(<-requests)
+	if err := json.Unmarshal(encoded, &body); err != nil {
+		t.Fatal(err)
+	}
+
+	resource := body.ResourceSpans[0].Resource.Attributes
+	if len(resource) != 1 || resource[0].Key != "service.name" || resource[0].Value.StringValue != "bikeshare-directions" {
+		t.Errorf("resource attributes = %+v, want service.name", resource)
+	}
+
+	span := body.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	if span.Name != "span" || span.Status.Code != 2 || span.Status.Message != "failed" {
+		t.Errorf("span = %+v", span)
+	}
+}
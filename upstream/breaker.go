@@ -0,0 +1,130 @@
+package upstream
+
+import (
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+const (
+	// BreakerClosed lets all calls through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails all calls immediately
+	BreakerOpen
+	// BreakerHalfOpen lets a single probe call through
+	BreakerHalfOpen
+)
+
+func (bs BreakerState) String() string {
+	switch bs {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// breaker opens after threshold consecutive failures. After timeout,
+// a single probe call is let through, which either closes the breaker
+// or opens it again.
+type breaker struct {
+	mutex *sync.Mutex
+
+	threshold int // 0 disables the breaker
+	timeout   time.Duration
+
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(threshold int, timeout time.Duration) *breaker {
+	return &breaker{
+		mutex:     &sync.Mutex{},
+		threshold: threshold,
+		timeout:   timeout,
+	}
+}
+
+// allow reports whether a call may be made
+func (b *breaker) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.threshold <= 0 {
+		return true
+	}
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.timeout {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return true
+
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+
+	default:
+		return true
+	}
+}
+
+func (b *breaker) success() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.state = BreakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// release ends a call that neither succeeded nor failed (e.g. abandoned
+// by the caller). A probe it was making can be made again by the next call.
+func (b *breaker) release() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.probing = false
+}
+
+func (b *breaker) failure() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.failures++
+
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+		b.probing = false
+	}
+}
+
+func (b *breaker) State() BreakerState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.timeout {
+		return BreakerHalfOpen
+	}
+
+	return b.state
+}
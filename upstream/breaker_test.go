@@ -0,0 +1,110 @@
+package upstream
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+
+	const timeout = 20 * time.Millisecond
+
+	// Steps are applied in order to a breaker with threshold 2
+	type step struct {
+		action string // allow, success, failure, release or wait
+		allow  bool   // Result of allow
+		state  BreakerState
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"opens after threshold failures", []step{
+			{action: "allow", allow: true, state: BreakerClosed},
+			{action: "failure", state: BreakerClosed},
+			{action: "allow", allow: true, state: BreakerClosed},
+			{action: "failure", state: BreakerOpen},
+			{action: "allow", allow: false, state: BreakerOpen},
+		}},
+		{"success resets failures", []step{
+			{action: "failure", state: BreakerClosed},
+			{action: "success", state: BreakerClosed},
+			{action: "failure", state: BreakerClosed},
+			{action: "allow", allow: true, state: BreakerClosed},
+		}},
+		{"probe success closes", []step{
+			{action: "failure"},
+			{action: "failure", state: BreakerOpen},
+			{action: "wait", state: BreakerHalfOpen},
+			{action: "allow", allow: true, state: BreakerHalfOpen},
+			{action: "allow", allow: false, state: BreakerHalfOpen},
+			{action: "success", state: BreakerClosed},
+			{action: "allow", allow: true, state: BreakerClosed},
+		}},
+		{"probe failure opens again", []step{
+			{action: "failure"},
+			{action: "failure", state: BreakerOpen},
+			{action: "wait", state: BreakerHalfOpen},
+			{action: "allow", allow: true, state: BreakerHalfOpen},
+			{action: "failure", state: BreakerOpen},
+			{action: "allow", allow: false, state: BreakerOpen},
+		}},
+		{"abandoned probe is released", []step{
+			{action: "failure"},
+			{action: "failure", state: BreakerOpen},
+			{action: "wait", state: BreakerHalfOpen},
+			{action: "allow", allow: true, state: BreakerHalfOpen},
+			{action: "release", state: BreakerHalfOpen},
+			{action: "allow", allow: true, state: BreakerHalfOpen},
+			{action: "allow", allow: false, state: BreakerHalfOpen},
+			{action: "success", state: BreakerClosed},
+		}},
+		{"release while closed", []step{
+			{action: "allow", allow: true, state: BreakerClosed},
+			{action: "release", state: BreakerClosed},
+			{action: "allow", allow: true, state: BreakerClosed},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			b := newBreaker(2, timeout)
+
+			for i, s := range test.steps {
+				switch s.action {
+				case "allow":
+					if allow := b.allow(); allow != s.allow {
+						t.Fatalf("step %d: allow() = %v, want %v", i, allow, s.allow)
+					}
+				case "success":
+					b.success()
+				case "failure":
+					b.failure()
+				case "release":
+					b.release()
+				case "wait":
+					time.Sleep(timeout)
+				}
+
+				if state := b.State(); state != s.state {
+					t.Fatalf("step %d (%s): State() = %s, want %s", i, s.action, state, s.state)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+
+	b := newBreaker(0, time.Minute)
+
+	for i := 0; i < 10; i++ {
+		b.failure()
+	}
+
+	if !b.allow() || b.State() != BreakerClosed {
+		t.Errorf("disabled breaker is %s", b.State())
+	}
+}
@@ -0,0 +1,32 @@
+package upstream
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// CircuitOpenError is returned when calls to an upstream are
+// rejected by its circuit breaker
+type CircuitOpenError struct {
+	upstream string
+}
+
+// NewCircuitOpenError creates a new CircuitOpenError
+func NewCircuitOpenError(upstream string) *CircuitOpenError {
+	return &CircuitOpenError{upstream}
+}
+
+func (coe *CircuitOpenError) Error() string {
+	return fmt.Sprintf("Circuit breaker for upstream %s is open", coe.upstream)
+}
+
+// StripURL returns the cause of errors of the http package, without the
+// request URL, whose query may contain API keys
+func StripURL(err error) error {
+
+	if urlErr, ok := err.(*url.Error); ok {
+		return urlErr.Err
+	}
+
+	return err
+}
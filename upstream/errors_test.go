@@ -0,0 +1,27 @@
+package upstream
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestStripURL(t *testing.T) {
+
+	cause := errors.New("connection refused")
+
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{&url.Error{Op: "Get", URL: "http://host/?key=secret", Err: cause}, cause},
+		{cause, cause},
+		{nil, nil},
+	}
+
+	for _, test := range tests {
+		if err := StripURL(test.err); err != test.want {
+			t.Errorf("StripURL(%v) = %v, want %v", test.err, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/health"
+)
+
+// breakerCheck reports the circuit breakers of interchangeable upstreams,
+// e.g. routing providers with failover. It is DOWN only while all of
+// their breakers are open, as any other upstream can still serve calls.
+type breakerCheck struct {
+	name      string
+	upstreams []string
+}
+
+// NewBreakerCheck creates a HealthChecker for the circuit breakers of the
+// upstreams with the specified names. Clients created later with the
+// same names (e.g. after a config change) are checked instead.
+func NewBreakerCheck(name string, upstreams ...string) health.HealthChecker {
+	return &breakerCheck{name: name, upstreams: upstreams}
+}
+
+func (bc *breakerCheck) Name() string {
+	return bc.name
+}
+
+func (bc *breakerCheck) Check(ctx context.Context) (map[string]interface{}, error) {
+
+	clientsMutex.Lock()
+	defer clientsMutex.Unlock()
+
+	data := make(map[string]interface{}, len(bc.upstreams))
+	open := 0
+
+	for _, name := range bc.upstreams {
+		c, ok := clients[name]
+		if !ok {
+			// Not created yet, calls are not rejected
+			data[name] = BreakerClosed.String()
+			continue
+		}
+
+		state := c.BreakerState()
+		data[name] = state.String()
+		if state == BreakerOpen {
+			open++
+		}
+	}
+
+	if len(bc.upstreams) > 0 && open == len(bc.upstreams) {
+		return data, errors.New("Circuit breakers of all upstreams are open: " + strings.Join(bc.upstreams, ", "))
+	}
+
+	return data, nil
+}
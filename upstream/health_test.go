@@ -0,0 +1,48 @@
+package upstream
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBreakerCheck(t *testing.T) {
+
+	tests := []struct {
+		open []string
+		down bool
+	}{
+		{nil, false},
+		{[]string{"maps"}, false},
+		{[]string{"graphhopper"}, false},
+		{[]string{"maps", "graphhopper"}, true},
+	}
+
+	for _, test := range tests {
+		maps := New(t.Name()+"maps", Options{BreakerThreshold: 1, BreakerTimeout: time.Hour})
+		graphhopper := New(t.Name()+"graphhopper", Options{BreakerThreshold: 1, BreakerTimeout: time.Hour})
+
+		for _, name := range test.open {
+			map[string]*Client{"maps": maps, "graphhopper": graphhopper}[name].breaker.failure()
+		}
+
+		check := NewBreakerCheck("RoutingCircuitBreakerHealthCheck", maps.Name(), graphhopper.Name())
+		data, err := check.Check(context.Background())
+
+		if down := err != nil; down != test.down {
+			t.Errorf("open %v: Check() error = %v, want down %t", test.open, err, test.down)
+		}
+
+		for _, c := range []*Client{maps, graphhopper} {
+			if data[c.Name()] != c.BreakerState().String() {
+				t.Errorf("open %v: data[%s] = %v, want %s", test.open, c.Name(), data[c.Name()], c.BreakerState())
+			}
+		}
+	}
+
+	// Upstreams without a Client yet do not reject calls
+	check := NewBreakerCheck("CatalogueCircuitBreakerHealthCheck", t.Name()+"missing")
+	if data, err := check.Check(context.Background()); err != nil || data[t.Name()+"missing"] != BreakerClosed.String() {
+		t.Errorf("uncreated upstream: Check() = %v, %v, want closed", data, err)
+	}
+}
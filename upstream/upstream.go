@@ -0,0 +1,308 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/logging"
+	"github.com/nimbo-stratuz/bikeshare-directions/metrics"
+	"github.com/nimbo-stratuz/bikeshare-directions/tracing"
+)
+
+// DeadlineHeader carries the time (in milliseconds) an upstream
+// service has left to respond
+const DeadlineHeader = "X-Request-Timeout"
+
+// Options configure a Client. Tags bind them to config keys
+// (see config.Config.Decode); durations default to milliseconds.
+type Options struct {
+	Timeout           time.Duration `config:"timeout" default:"1000"` // Timeout of a call, including retries
+	PropagateDeadline bool          `config:"-"`                      // Send the remaining time in DeadlineHeader
+	PropagateTrace    bool          `config:"-"`                      // Send the trace context in the traceparent header
+
+	Retries    int           `config:"retries" default:"2"`       // Retries of idempotent calls after a failure
+	Backoff    time.Duration `config:"backoff" default:"100"`     // Base delay between retries, doubled on every retry
+	MaxBackoff time.Duration `config:"maxbackoff" default:"1000"` // Maximum delay between retries
+
+	BreakerThreshold int           `config:"breaker.threshold" default:"5"`   // Consecutive failures that open the circuit breaker (0 disables it)
+	BreakerTimeout   time.Duration `config:"breaker.timeout" default:"30000"` // Time the circuit breaker stays open before a probe call
+}
+
+// Client is an HTTP client for a single upstream service.
+// Each call is bounded by the deadline of the incoming request
+// context and by the upstream's own timeout, whichever comes first.
+// Failed idempotent calls are retried with exponential backoff, and
+// consecutive failures open a circuit breaker that fails calls fast.
+type Client struct {
+	name    string
+	options Options
+	breaker *breaker
+
+	http *http.Client
+}
+
+var (
+	clientsMutex = &sync.Mutex{}
+	clients      = map[string]*Client{}
+)
+
+// New creates a Client for the upstream with the specified name
+func New(name string, options Options) *Client {
+
+	// Validated by the config schema, but a negative count of attempts
+	// would leave Do without a response
+	if options.Retries < 0 {
+		options.Retries = 0
+	}
+	if options.BreakerThreshold < 0 {
+		options.BreakerThreshold = 0
+	}
+
+	c := &Client{
+		name:    name,
+		options: options,
+		breaker: newBreaker(options.BreakerThreshold, options.BreakerTimeout),
+		http:    &http.Client{},
+	}
+
+	clientsMutex.Lock()
+	clients[name] = c
+	clientsMutex.Unlock()
+
+	return c
+}
+
+// Clients returns all created Clients, sorted by name
+func Clients() []*Client {
+	clientsMutex.Lock()
+	defer clientsMutex.Unlock()
+
+	list := make([]*Client, 0, len(clients))
+	for _, c := range clients {
+		list = append(list, c)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+
+	return list
+}
+
+// Name returns the name of the upstream
+func (c *Client) Name() string {
+	return c.name
+}
+
+// BreakerState returns the state of the upstream's circuit breaker
+func (c *Client) BreakerState() BreakerState {
+	return c.breaker.State()
+}
+
+type idempotentKey struct{}
+
+// Idempotent marks a request as safe to retry, regardless of its method
+// (e.g. a POST request that only queries the upstream)
+func Idempotent(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), idempotentKey{}, true))
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+
+	idempotent, _ := req.Context().Value(idempotentKey{}).(bool)
+	return idempotent
+}
+
+// Do sends the request with a deadline derived from ctx.
+// The deadline applies until the response body is closed.
+func (c *Client) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
+
+	attempts := 1
+	if isIdempotent(req) && (req.Body == nil || req.GetBody != nil) {
+		attempts += c.options.Retries
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, c.options.Timeout)
+
+	callCtx, span := tracing.StartSpan(callCtx, "HTTP "+req.Method+" "+c.name, tracing.KindClient)
+	defer span.End()
+
+	// The query may contain API keys
+	span.SetAttribute("upstream", c.name)
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+
+	var (
+		resp *http.Response
+		err  error
+	)
+
+	for attempt := 0; attempt < attempts; attempt++ {
+
+		if attempt == 0 && !c.breaker.allow() {
+			cancel()
+			err := NewCircuitOpenError(c.name)
+			metrics.ObserveUpstream(c.name, time.Now(), err)
+			span.SetError(err)
+			return nil, err
+		}
+
+		if attempt > 0 {
+			if !c.wait(callCtx, attempt) || !c.breaker.allow() {
+				break
+			}
+
+			logging.FromContext(ctx).
+				WithField("upstream", c.name).
+				Debugf("Retrying call to upstream (Retry #%d)", attempt)
+			span.SetAttribute("retries", attempt)
+
+			if resp != nil {
+				// Discard the failed response
+				io.Copy(ioutil.Discard, resp.Body)
+				resp.Body.Close()
+			}
+		}
+
+		start := time.Now()
+		resp, err = c.attempt(callCtx, req, attempt)
+
+		if err != nil {
+			metrics.ObserveUpstream(c.name, start, err)
+		} else if failed(resp, err) {
+			metrics.ObserveUpstream(c.name, start, errors.New(resp.Status))
+		} else {
+			metrics.ObserveUpstream(c.name, start, nil)
+		}
+
+		if !failed(resp, err) {
+			c.breaker.success()
+			break
+		}
+
+		// Calls abandoned by the caller say nothing about the upstream
+		if ctx.Err() == context.Canceled {
+			c.breaker.release()
+			break
+		}
+
+		c.breaker.failure()
+
+		if callCtx.Err() != nil {
+			break
+		}
+	}
+
+	if resp == nil {
+		cancel()
+		span.SetError(StripURL(err))
+		return nil, err
+	}
+
+	span.SetAttribute("http.status_code", resp.StatusCode)
+	if failed(resp, nil) {
+		span.SetError(errors.New(resp.Status))
+	}
+
+	resp.Body = &cancelBody{resp.Body, cancel}
+
+	return resp, nil
+}
+
+func (c *Client) attempt(ctx context.Context, req *http.Request, attempt int) (*http.Response, error) {
+
+	req = req.WithContext(ctx)
+
+	if attempt > 0 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && c.options.PropagateDeadline {
+		// Copy headers, they are shared with the original request
+		req.Header = cloneHeader(req.Header)
+
+		remaining := time.Until(deadline) / time.Millisecond
+		req.Header.Set(DeadlineHeader, strconv.FormatInt(int64(remaining), 10))
+	}
+
+	if c.options.PropagateTrace {
+		req.Header = cloneHeader(req.Header)
+		tracing.Inject(ctx, req.Header)
+	}
+
+	return c.http.Do(req)
+}
+
+// wait sleeps before a retry, using exponential backoff with full jitter.
+// It returns false if ctx is done before the retry could be made.
+func (c *Client) wait(ctx context.Context, attempt int) bool {
+
+	delay := c.options.Backoff << uint(attempt-1)
+	if delay > c.options.MaxBackoff || delay <= 0 {
+		delay = c.options.MaxBackoff
+	}
+
+	if delay > 0 {
+		delay = time.Duration(rand.Int63n(int64(delay)))
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+		return false
+	}
+
+	select {
+	case <-time.After(delay):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// failed reports whether a call failed in a way that may succeed
+// when retried
+func failed(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+}
+
+func cloneHeader(header http.Header) http.Header {
+
+	clone := make(http.Header, len(header))
+	for k, v := range header {
+		clone[k] = append([]string(nil), v...)
+	}
+
+	return clone
+}
+
+// cancelBody releases the context of a request when its response
+// body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (cb *cancelBody) Close() error {
+	err := cb.ReadCloser.Close()
+	cb.cancel()
+	return err
+}
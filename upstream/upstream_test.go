@@ -0,0 +1,123 @@
+package upstream
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nimbo-stratuz/bikeshare-directions/tracing"
+)
+
+func TestDoAbandonedProbe(t *testing.T) {
+
+	var status int32 = http.StatusInternalServerError
+	requests := make(chan struct{}, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- struct{}{}
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer server.Close()
+
+	c := New(t.Name(), Options{
+		Timeout:          time.Second,
+		BreakerThreshold: 1,
+		BreakerTimeout:   20 * time.Millisecond,
+	})
+
+	get := func(ctx context.Context, path string) (*http.Response, error) {
+		req, _ := http.NewRequest("GET", server.URL+path, nil)
+		return c.Do(ctx, req)
+	}
+
+	// A failure opens the breaker
+	if resp, err := get(context.Background(), "/"); err != nil {
+		t.Fatal(err)
+	} else {
+		resp.Body.Close()
+	}
+	<-requests
+	if state := c.BreakerState(); state != BreakerOpen {
+		t.Fatalf("breaker is %s, want open", state)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	// The probe is abandoned by its caller
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-requests
+		cancel()
+	}()
+	if _, err := get(ctx, "/slow"); err == nil {
+		t.Fatal("abandoned call succeeded")
+	}
+
+	// The next call probes the upstream again and closes the breaker
+	atomic.StoreInt32(&status, http.StatusOK)
+
+	resp, err := get(context.Background(), "/")
+	if err != nil {
+		t.Fatalf("call after an abandoned probe: %v", err)
+	}
+	resp.Body.Close()
+
+	if state := c.BreakerState(); state != BreakerClosed {
+		t.Errorf("breaker is %s, want closed", state)
+	}
+}
+
+func TestDoSpanHidesURL(t *testing.T) {
+
+	exporter := tracing.NewMemoryExporter()
+	tracing.Start(exporter, 1)
+
+	// Nothing listens on the address of a closed server
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	c := New(t.Name(), Options{Timeout: time.Second})
+
+	req, _ := http.NewRequest("GET", server.URL+"/route?key=s3cr3t", nil)
+	if _, err := c.Do(context.Background(), req); err == nil {
+		t.Fatal("call to a closed server succeeded")
+	}
+
+	tracing.Stop()
+
+	spans := exporter.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("%d spans exported, want 1", len(spans))
+	}
+
+	span := spans[0]
+	if span.Error == "" {
+		t.Error("span has no error")
+	}
+	if strings.Contains(span.Error, "s3cr3t") || strings.Contains(span.Attributes["http.url"], "s3cr3t") {
+		t.Errorf("span reveals the query: %q, %q", span.Error, span.Attributes["http.url"])
+	}
+}
+
+func TestNewClampsOptions(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	c := New(t.Name(), Options{Timeout: time.Second, Retries: -1, BreakerThreshold: -1})
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := c.Do(context.Background(), Idempotent(req))
+	if err != nil {
+		t.Fatalf("Do() with negative retries: %v", err)
+	}
+	resp.Body.Close()
+}